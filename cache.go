@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	defaultMatchCacheTTL   = 30 * 24 * time.Hour
+	matchCacheSaveInterval = 30 * time.Second
+)
+
+// cachedMatch is a single matched Spotify track.
+type cachedMatch struct {
+	TrackID   spotify.ID `json:"track"`
+	MatchedAt time.Time  `json:"matchedAt"`
+}
+
+// matchCache remembers which Spotify track an entry was matched to, keyed by the keys from entryKeys.
+// It lives in memory and is periodically written to disk, see jsonFile.
+type matchCache struct {
+	jsonFile
+	ttl     time.Duration
+	matches map[string]cachedMatch
+}
+
+var matches = newMatchCache()
+
+func newMatchCache() *matchCache {
+	file := os.Getenv("MATCH_CACHE_FILE")
+	if file == "" {
+		file = "matches.json"
+	}
+
+	ttl := defaultMatchCacheTTL
+	if d, err := time.ParseDuration(os.Getenv("MATCH_CACHE_TTL")); err == nil {
+		ttl = d
+	}
+
+	c := &matchCache{
+		ttl:     ttl,
+		matches: make(map[string]cachedMatch),
+	}
+	c.jsonFile = newJSONFile(file, &c.matches)
+	return c
+}
+
+// Get returns the track the given entry was matched to, if any and not yet expired.
+// Tracks the given user picked themselves while reviewing a list come first, see SetReviewed.
+func (c *matchCache) Get(userID string, e Entry) (spotify.ID, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := entryKeys(e)
+	if userID != "" {
+		keys = append(reviewedKeys(userID, keys), keys...)
+	}
+
+	for _, k := range keys {
+		m, ok := c.matches[k]
+		if !ok || time.Since(m.MatchedAt) > c.ttl {
+			continue
+		}
+
+		return m.TrackID, true
+	}
+
+	return "", false
+}
+
+// Set remembers that the given entry was matched to track id.
+func (c *matchCache) Set(e Entry, id spotify.ID) {
+	c.Lock()
+	defer c.Unlock()
+
+	m := cachedMatch{TrackID: id, MatchedAt: time.Now()}
+	for _, k := range entryKeys(e) {
+		c.matches[k] = m
+	}
+	c.dirty = true
+}
+
+// SetReviewed remembers that the given user picked track id for the given entry.
+// Only that user gets the track, as anyone can pick any track for an entry and the cache is shared by everyone.
+func (c *matchCache) SetReviewed(userID string, e Entry, id spotify.ID) {
+	c.Lock()
+	defer c.Unlock()
+
+	m := cachedMatch{TrackID: id, MatchedAt: time.Now()}
+	for _, k := range reviewedKeys(userID, entryKeys(e)) {
+		c.matches[k] = m
+	}
+	c.dirty = true
+}
+
+// Reviewed returns the tracks the given user picked themselves, by entry key.
+func (c *matchCache) Reviewed(userID string) map[string]spotify.ID {
+	c.RLock()
+	defer c.RUnlock()
+
+	reviewed := make(map[string]spotify.ID)
+	prefix := reviewedKey(userID, "")
+	for k, m := range c.matches {
+		if userID != "" && strings.HasPrefix(k, prefix) {
+			reviewed[strings.TrimPrefix(k, prefix)] = m.TrackID
+		}
+	}
+
+	return reviewed
+}
+
+// Forget removes the tracks the given user picked themselves and returns how many there were.
+func (c *matchCache) Forget(userID string) int {
+	reviewed := c.Reviewed(userID)
+
+	c.Lock()
+	defer c.Unlock()
+
+	for k := range reviewed {
+		delete(c.matches, reviewedKey(userID, k))
+	}
+	if len(reviewed) > 0 {
+		c.dirty = true
+	}
+
+	return len(reviewed)
+}
+
+func reviewedKey(userID string, key string) string {
+	return "user:" + userID + "|" + key
+}
+
+func reviewedKeys(userID string, keys []string) []string {
+	reviewed := make([]string, len(keys))
+	for i, k := range keys {
+		reviewed[i] = reviewedKey(userID, k)
+	}
+
+	return reviewed
+}
+
+// Purge removes the given keys from the cache, or everything if no keys are given.
+// It returns the number of removed matches.
+func (c *matchCache) Purge(keys ...string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	n := 0
+	if len(keys) == 0 {
+		n = len(c.matches)
+		c.matches = make(map[string]cachedMatch)
+	}
+
+	for _, k := range keys {
+		if _, ok := c.matches[k]; ok {
+			delete(c.matches, k)
+			n++
+		}
+	}
+
+	// expired matches are dropped on every purge as well
+	for k, m := range c.matches {
+		if time.Since(m.MatchedAt) > c.ttl {
+			delete(c.matches, k)
+			n++
+		}
+	}
+
+	c.dirty = true
+	return n
+}
+
+// handlePurgeCache removes matches from the cache. It requires the ADMIN_TOKEN as bearer token.
+// Use "id" to purge a single catalog ID, "artist" and "title" to purge a single track or "all=1" to purge everything.
+func handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	keys := make([]string, 0)
+	if id := strings.TrimSpace(q.Get("id")); id != "" {
+		keys = append(keys, "id:"+id)
+	}
+	if q.Get("artist") != "" && q.Get("title") != "" {
+		keys = append(keys, entryKeys(Entry{Artist: q.Get("artist"), Title: q.Get("title")})...)
+	}
+	if len(keys) == 0 && q.Get("all") != "1" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	n := matches.Purge(keys...)
+	if err := matches.Save(); err != nil {
+		log.Println(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"purged": n,
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestMatchCacheReviewedIsPerUser(t *testing.T) {
+	c := newMatchCache()
+	e := Entry{Artist: "Queen", Title: "Bohemian Rhapsody", CatalogID: "q1"}
+
+	c.Set(e, "studio")
+	c.SetReviewed("danny", e, "live")
+
+	if id, _ := c.Get("danny", e); id != "live" {
+		t.Errorf("got %q for the user who reviewed, want their own pick", id)
+	}
+	if id, _ := c.Get("someone", e); id != "studio" {
+		t.Errorf("got %q for another user, want the shared match", id)
+	}
+	if id, _ := c.Get("", e); id != "studio" {
+		t.Errorf("got %q without a user, want the shared match", id)
+	}
+
+	if n := c.Forget("danny"); n != 2 {
+		t.Errorf("forgot %d reviewed keys, want 2", n)
+	}
+	if id, _ := c.Get("danny", e); id != "studio" {
+		t.Errorf("got %q after forgetting, want the shared match", id)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const errCompareLists = "Geef precies twee lijstjes op om te vergelijken."
+
+// comparison holds the overlap and differences between two lists.
+type comparison struct {
+	Shared     []Entry `json:"shared"`
+	OnlyA      []Entry `json:"onlyA"`
+	OnlyB      []Entry `json:"onlyB"`
+	Similarity float64 `json:"similarity"`
+}
+
+// handleCompare compares two lijstjes and, if asked for, creates a playlist of the tracks they share.
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		URLs     []string `json:"urls"`
+		Playlist bool     `json:"playlist"`
+		playlistOptions
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if err != nil || len(data.URLs) != 2 {
+		je.Encode(map[string]interface{}{
+			"error": errCompareLists,
+		})
+		return
+	}
+	if data.Playlist && !checkPlaylistOptions(je, r, &data.playlistOptions) {
+		return
+	}
+
+	lists := make([]*List, 2)
+	for i, url := range data.URLs {
+		lists[i], err = fetchList(url)
+		if err != nil {
+			writeListError(je, err)
+			return
+		}
+
+		logLijstje(r, url)
+	}
+
+	c := compareLists(lists[0], lists[1])
+
+	// the comparison was shown before, so only the job creating the playlist is returned
+	if data.Playlist && len(c.Shared) > 0 {
+		writePlaylist(w, r, &List{
+			Name:    lists[0].Name + " & " + lists[1].Name,
+			Title:   lists[0].Title,
+			Edition: lists[0].Edition,
+			Entries: c.Shared,
+		}, data.playlistOptions)
+		return
+	}
+
+	je.Encode(map[string]interface{}{
+		"a":          lists[0].Name,
+		"b":          lists[1].Name,
+		"shared":     c.Shared,
+		"onlyA":      c.OnlyA,
+		"onlyB":      c.OnlyB,
+		"similarity": c.Similarity,
+	})
+}
+
+// compareLists returns the entries both lists share and the entries unique to each of them.
+// Similarity is the Jaccard index of both lists: the number of shared tracks divided by the number of distinct tracks.
+func compareLists(a, b *List) *comparison {
+	c := &comparison{
+		Shared: make([]Entry, 0),
+		OnlyA:  make([]Entry, 0),
+		OnlyB:  make([]Entry, 0),
+	}
+
+	// duplicates on b are matched in order, so the first copy is the one shared
+	index := make(map[string]int)
+	for i, e := range b.Entries {
+		for _, k := range entryKeys(e) {
+			if _, ok := index[k]; !ok {
+				index[k] = i
+			}
+		}
+	}
+
+	matched := make(map[int]bool)
+	for _, e := range a.Entries {
+		found := false
+		for _, k := range entryKeys(e) {
+			if i, ok := index[k]; ok && !matched[i] {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+
+		if found {
+			c.Shared = append(c.Shared, e)
+		} else {
+			c.OnlyA = append(c.OnlyA, e)
+		}
+	}
+
+	for i, e := range b.Entries {
+		if !matched[i] {
+			c.OnlyB = append(c.OnlyB, e)
+		}
+	}
+
+	if total := len(c.Shared) + len(c.OnlyA) + len(c.OnlyB); total > 0 {
+		c.Similarity = float64(len(c.Shared)) / float64(total)
+	}
+
+	return c
+}
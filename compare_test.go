@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestCompareLists(t *testing.T) {
+	a := &List{Entries: []Entry{
+		{Artist: "Queen", Title: "Bohemian Rhapsody"},
+		{Artist: "Eagles", Title: "Hotel California", CatalogID: "e1"},
+		{Artist: "Boudewijn de Groot", Title: "Avond"},
+	}}
+	b := &List{Entries: []Entry{
+		{Artist: "Queen", Title: "Bohemian Rhapsody - Remastered 2011"},
+		{Artist: "The Eagles", Title: "Hotel California (Live)", CatalogID: "e1"},
+		{Artist: "Queen", Title: "Bohemian Rhapsody"},
+		{Artist: "André Hazes", Title: "Zij Gelooft In Mij"},
+	}}
+
+	c := compareLists(a, b)
+
+	if len(c.Shared) != 2 || c.Shared[0].Artist != "Queen" || c.Shared[1].Artist != "Eagles" {
+		t.Errorf("got shared %+v, want Queen and Eagles", c.Shared)
+	}
+	if len(c.OnlyA) != 1 || c.OnlyA[0].Artist != "Boudewijn de Groot" {
+		t.Errorf("got only a %+v, want Boudewijn de Groot", c.OnlyA)
+	}
+
+	// the duplicate is the second copy of Queen, the first one is shared
+	if len(c.OnlyB) != 2 || c.OnlyB[0].Title != "Bohemian Rhapsody" || c.OnlyB[1].Artist != "André Hazes" {
+		t.Errorf("got only b %+v, want the duplicate Queen and André Hazes", c.OnlyB)
+	}
+
+	if want := 2.0 / 5.0; c.Similarity != want {
+		t.Errorf("got similarity %v, want %v", c.Similarity, want)
+	}
+
+	if c := compareLists(&List{}, &List{}); c.Similarity != 0 {
+		t.Errorf("got similarity %v for empty lists, want 0", c.Similarity)
+	}
+}
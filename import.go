@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxImportSize   = 1 << 20 // 1 MB
+	errInvalidInput = "Ik kan geen enkel nummer uit je lijstje halen. Zet per regel \"Artiest - Titel\"."
+)
+
+var (
+	// textSeparators are tried in order to split a line into artist and title
+	textSeparators = []string{" - ", " – ", " — ", "\t", " | ", " / ", ";", " -", "- ", "-"}
+
+	// textNumbering matches leading list numbering like "1.", "12)", "#3" or "4:".
+	// A bare number is not numbering, it starts artists like "4 Non Blondes" and "2 Unlimited".
+	textNumbering = regexp.MustCompile(`^\s*(?:#\s*\d+\s*[.):]?|\d+\s*[.):])\s+`)
+)
+
+// handleImportPlaylist creates a playlist from pasted "Artist - Title" lines or an uploaded CSV file.
+// Plain text is posted as JSON ({"name": "...", "text": "..."}), CSV files as multipart form with a "file" field.
+func handleImportPlaylist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var list *List
+	var opts playlistOptions
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		list, opts, err = importCSV(r)
+	} else {
+		list, opts, err = importText(r)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	if err != nil || len(list.Entries) == 0 {
+		je.Encode(map[string]interface{}{
+			"error": errInvalidInput,
+		})
+		return
+	}
+	if !checkPlaylistOptions(je, r, &opts) {
+		return
+	}
+
+	writePlaylist(w, r, list, opts)
+}
+
+// importText reads a list from a JSON body holding free text.
+func importText(r *http.Request) (*List, playlistOptions, error) {
+	var data struct {
+		Name string `json:"name"`
+		Text string `json:"text"`
+		playlistOptions
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		return nil, data.playlistOptions, err
+	}
+
+	return &List{
+		Name:    importName(data.Name),
+		Title:   "Top 2000",
+		Entries: parseTextList(strings.NewReader(data.Text)),
+	}, data.playlistOptions, nil
+}
+
+// importCSV reads a list from an uploaded CSV file.
+func importCSV(r *http.Request) (*List, playlistOptions, error) {
+	opts := playlistOptions{
+		Visibility: r.FormValue("visibility"),
+		Order:      r.FormValue("order"),
+	}
+	opts.Seed, _ = strconv.ParseInt(r.FormValue("seed"), 10, 64)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, opts, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	// spreadsheets saved with a Dutch locale use semicolons
+	comma := ','
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		comma = ';'
+	}
+
+	ranked, err := readRankingCSV(bytes.NewReader(data), comma)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	list := &List{
+		Name:    importName(r.FormValue("name")),
+		Title:   "Top 2000",
+		Entries: make([]Entry, 0, len(ranked)),
+	}
+	for _, e := range ranked {
+		list.Entries = append(list.Entries, e.Entry)
+	}
+
+	return list, opts, nil
+}
+
+func importName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "Mijn"
+	}
+
+	return name
+}
+
+// parseTextList reads one "Artist - Title" entry per line.
+// Leading numbering, quotes and empty lines are ignored, as are lines without a recognizable separator.
+func parseTextList(r io.Reader) []Entry {
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = textNumbering.ReplaceAllString(line, "")
+		if line == "" {
+			continue
+		}
+
+		for _, sep := range textSeparators {
+			parts := strings.SplitN(line, sep, 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			artist := strings.Trim(parts[0], " \t\"'“”")
+			title := strings.Trim(parts[1], " \t\"'“”")
+			if artist == "" || title == "" {
+				continue
+			}
+
+			entries = append(entries, Entry{
+				Artist: artist,
+				Title:  title,
+			})
+			break
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTextList(t *testing.T) {
+	text := `1. Queen - Bohemian Rhapsody
+2) Eagles – Hotel California
+#3 Boudewijn de Groot - Avond
+4: "André Hazes" - "Zij Gelooft In Mij"
+
+4 Non Blondes - What's Up
+2 Unlimited - No Limit
+10. 10cc - I'm Not In Love
+geen nummer hier
+`
+
+	want := []Entry{
+		{Artist: "Queen", Title: "Bohemian Rhapsody"},
+		{Artist: "Eagles", Title: "Hotel California"},
+		{Artist: "Boudewijn de Groot", Title: "Avond"},
+		{Artist: "André Hazes", Title: "Zij Gelooft In Mij"},
+		{Artist: "4 Non Blondes", Title: "What's Up"},
+		{Artist: "2 Unlimited", Title: "No Limit"},
+		{Artist: "10cc", Title: "I'm Not In Love"},
+	}
+
+	got := parseTextList(strings.NewReader(text))
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries %+v, want %d", len(got), got, len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	maxConcurrentJobs = 4
+	jobTimeout        = 10 * time.Minute
+	jobRetention      = time.Hour
+	jobHeartbeat      = 15 * time.Second
+)
+
+// jobEvent is a single event in the life of a job, as sent to the client.
+type jobEvent struct {
+	Type      string     `json:"type"`
+	Done      int        `json:"done,omitempty"`
+	Index     int        `json:"index"`
+	Total     int        `json:"total,omitempty"`
+	Entry     *Entry     `json:"entry,omitempty"`
+	Track     spotify.ID `json:"track,omitempty"`
+	Playlist  spotify.ID `json:"playlist,omitempty"`
+	Unmatched []Entry    `json:"unmatched,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// job is a playlist being created in the background.
+// All events are kept, so clients connecting late still get the full picture.
+type job struct {
+	ID      string
+	owner   string
+	created time.Time
+
+	sync.Mutex
+	events  []jobEvent
+	done    bool
+	changed chan struct{}
+}
+
+// Publish adds an event and wakes up everyone waiting for one.
+func (j *job) Publish(e jobEvent) {
+	j.publish(e, false)
+}
+
+// Finish publishes the final event of the job.
+func (j *job) Finish(e jobEvent) {
+	j.publish(e, true)
+}
+
+func (j *job) publish(e jobEvent, done bool) {
+	j.Lock()
+	defer j.Unlock()
+
+	j.events = append(j.events, e)
+	j.done = j.done || done
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Events returns all events starting at index from, whether the job is done
+// and a channel that is closed as soon as something changes.
+func (j *job) Events(from int) ([]jobEvent, bool, <-chan struct{}) {
+	j.Lock()
+	defer j.Unlock()
+
+	var events []jobEvent
+	if from < len(j.events) {
+		events = j.events[from:]
+	}
+
+	return events, j.done, j.changed
+}
+
+// jobQueue runs jobs in the background, a limited number at a time.
+type jobQueue struct {
+	slots chan struct{}
+
+	sync.Mutex
+	jobs map[string]*job
+}
+
+var jobs = &jobQueue{
+	slots: make(chan struct{}, maxConcurrentJobs),
+	jobs:  make(map[string]*job),
+}
+
+// Start queues fn as a new job for the given user and returns immediately.
+func (q *jobQueue) Start(owner string, fn func(ctx context.Context, j *job)) *job {
+	j := &job{
+		ID:      newJobID(),
+		owner:   owner,
+		created: time.Now(),
+		events:  make([]jobEvent, 0),
+		changed: make(chan struct{}),
+	}
+
+	q.Lock()
+	q.jobs[j.ID] = j
+	q.cleanup()
+	q.Unlock()
+
+	go func() {
+		j.Publish(jobEvent{Type: "queued"})
+
+		q.slots <- struct{}{}
+		defer func() { <-q.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+		defer cancel()
+
+		j.Publish(jobEvent{Type: "started"})
+		fn(ctx, j)
+	}()
+
+	return j
+}
+
+// Get returns the job with the given ID, if any.
+func (q *jobQueue) Get(id string) (*job, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	j, ok := q.jobs[id]
+	return j, ok
+}
+
+// Owned returns all jobs of the given user.
+func (q *jobQueue) Owned(owner string) []*job {
+	q.Lock()
+	defer q.Unlock()
+
+	owned := make([]*job, 0)
+	for _, j := range q.jobs {
+		if owner != "" && j.owner == owner {
+			owned = append(owned, j)
+		}
+	}
+
+	return owned
+}
+
+// Forget removes all jobs of the given user and returns how many there were.
+// Jobs still running are finished, but can no longer be followed.
+func (q *jobQueue) Forget(owner string) int {
+	q.Lock()
+	defer q.Unlock()
+
+	n := 0
+	for id, j := range q.jobs {
+		if owner != "" && j.owner == owner {
+			delete(q.jobs, id)
+			n++
+		}
+	}
+
+	return n
+}
+
+// cleanup forgets about jobs that are done and old enough. It expects q to be locked.
+func (q *jobQueue) cleanup() {
+	for id, j := range q.jobs {
+		j.Lock()
+		expired := j.done && time.Since(j.created) > jobRetention
+		j.Unlock()
+
+		if expired {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// handleJobEvents streams the events of a job as Server-Sent Events, at /api/jobs/{id}/events.
+func handleJobEvents(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	if !strings.HasSuffix(path, "/events") {
+		http.NotFound(w, r)
+		return
+	}
+
+	j, ok := jobs.Get(strings.TrimSuffix(path, "/events"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, errInternal, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(jobHeartbeat)
+	defer heartbeat.Stop()
+
+	next := 0
+	for {
+		events, done, changed := j.Events(next)
+		for _, e := range events {
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		next += len(events)
+		flusher.Flush()
+
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// npoShareURL is the base URL used to turn a bare share ID into a full share link.
+	npoShareURL = "https://stem.nporadio2.nl/"
+
+	// maxLinkRedirects is the number of redirects we follow for a single short link.
+	maxLinkRedirects = 3
+)
+
+var (
+	bareIDRegexp = regexp.MustCompile(`^\w+$`)
+
+	// shortLinkHosts are hosts whose links are followed to find out where they point to.
+	shortLinkHosts = map[string]bool{
+		"bit.ly":           true,
+		"t.co":             true,
+		"npo.nl":           true,
+		"m.nporadio2.nl":   true,
+		"nporadio2.nl":     true,
+		"www.nporadio2.nl": true,
+	}
+
+	// linkTargetHosts are the hosts short links may redirect to, besides other short links.
+	linkTargetHosts = map[string]bool{
+		"stem.nporadio2.nl": true,
+		"www.npo.nl":        true,
+	}
+
+	// linkClient only follows redirects to known hosts, see checkLinkRedirect.
+	linkClient = &http.Client{
+		Timeout:       5 * time.Second,
+		CheckRedirect: checkLinkRedirect,
+	}
+)
+
+// checkLinkRedirect stops following a short link once it redirects too often or to a host we do not know.
+// Together with only following links of shortLinkHosts, this means a pasted link can never make us request
+// arbitrary URLs, like internal or metadata addresses.
+func checkLinkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxLinkRedirects {
+		return errors.New("link: too many redirects")
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("link: redirect to scheme %q not allowed", req.URL.Scheme)
+	}
+
+	host := strings.ToLower(req.URL.Hostname())
+	if !shortLinkHosts[host] && !linkTargetHosts[host] {
+		return fmt.Errorf("link: redirect to host %q not allowed", host)
+	}
+
+	return nil
+}
+
+// linkError describes which part of a pasted link could not be understood.
+type linkError struct {
+	Link string
+	Part string
+	Hint string
+}
+
+func (e *linkError) Error() string {
+	return fmt.Sprintf("could not understand %s of link %q", e.Part, e.Link)
+}
+
+// resolveLink turns whatever the user pasted into a canonical URL that list sources can detect.
+// It accepts bare share IDs, links without scheme, query strings, fragments and trailing slashes,
+// and follows redirects of known short-link hosts.
+func resolveLink(raw string) (string, error) {
+	link := strings.TrimSpace(raw)
+	if link == "" {
+		return "", &linkError{Link: raw, Part: "link", Hint: "Je hebt geen link ingevuld."}
+	}
+
+	// a bare share ID, as copied from the end of a share link
+	if bareIDRegexp.MatchString(link) {
+		return npoShareURL + defaultNPOForm + "/share/" + link, nil
+	}
+
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", &linkError{Link: raw, Part: "link", Hint: "Dit lijkt geen link te zijn."}
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", &linkError{Link: raw, Part: "scheme", Hint: "Een link begint met http:// of https://."}
+	}
+
+	if u.Host == "" {
+		return "", &linkError{Link: raw, Part: "host", Hint: "Ik mis de website in je link."}
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+
+	if shortLinkHosts[u.Host] && !strings.Contains(u.Path, "/share/") {
+		u, err = followLink(u)
+		if err != nil {
+			return "", &linkError{Link: raw, Part: "redirect", Hint: "Ik kan niet zien waar deze link naartoe gaat."}
+		}
+	}
+
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// followLink follows the redirects of a short link and returns where it ends up.
+func followLink(u *url.URL) (*url.URL, error) {
+	resp, err := linkClient.Head(u.String())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	// some pages do not like HEAD requests, let the list sources decide what to do with those
+	if resp.StatusCode >= 400 {
+		return u, nil
+	}
+
+	return resp.Request.URL, nil
+}
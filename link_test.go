@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestResolveLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+		part string
+	}{
+		{"abc123", "https://stem.nporadio2.nl/top-2000/share/abc123", ""},
+		{"stem.nporadio2.nl/top-2000/share/abc123", "https://stem.nporadio2.nl/top-2000/share/abc123", ""},
+		{" https://STEM.nporadio2.nl/top-2000/share/abc123/?utm_source=whatsapp#top ", "https://stem.nporadio2.nl/top-2000/share/abc123", ""},
+		{"https://m.nporadio2.nl/top-2000/share/abc123/", "https://m.nporadio2.nl/top-2000/share/abc123", ""},
+		{"www.nporadio2.nl/top-2000/share/abc123?ref=app", "https://www.nporadio2.nl/top-2000/share/abc123", ""},
+		{"", "", "link"},
+		{"ftp://stem.nporadio2.nl/top-2000/share/abc123", "", "scheme"},
+		{"https:///top-2000/share/abc123", "", "host"},
+	}
+
+	for _, test := range tests {
+		got, err := resolveLink(test.link)
+		if test.part != "" {
+			le, ok := err.(*linkError)
+			if !ok || le.Part != test.part {
+				t.Errorf("resolveLink(%q) error = %v, want a %s error", test.link, err, test.part)
+			}
+			continue
+		}
+
+		if err != nil || got != test.want {
+			t.Errorf("resolveLink(%q) = %q, %v, want %q", test.link, got, err, test.want)
+		}
+	}
+}
+
+func TestCheckLinkRedirect(t *testing.T) {
+	tests := []struct {
+		to   string
+		hops int
+		ok   bool
+	}{
+		{"https://stem.nporadio2.nl/top-2000/share/abc123", 1, true},
+		{"https://t.co/abc", 1, true},
+		{"http://169.254.169.254/latest/meta-data/", 1, false},
+		{"http://localhost:8080/admin", 1, false},
+		{"file:///etc/passwd", 1, false},
+		{"https://stem.nporadio2.nl/top-2000/share/abc123", maxLinkRedirects, false},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.to)
+		via := make([]*http.Request, test.hops)
+		err := checkLinkRedirect(&http.Request{URL: u}, via)
+		if (err == nil) != test.ok {
+			t.Errorf("redirect to %s after %d hops: got %v, want ok = %v", test.to, test.hops, err, test.ok)
+		}
+	}
+}
+
+func TestDetectAliasShareLinks(t *testing.T) {
+	for _, link := range []string{
+		"https://m.nporadio2.nl/top-2000/share/abc123",
+		"www.nporadio2.nl/top-2000/share/abc123",
+		"https://www.npo.nl/top-2000/share/abc123",
+	} {
+		u, err := resolveLink(link)
+		if err != nil {
+			t.Errorf("resolveLink(%q): %v", link, err)
+			continue
+		}
+
+		if id, ok := newNPOSource().Detect(u); !ok || id != "top-2000/abc123" {
+			t.Errorf("Detect(%q) = %q, %v, want top-2000/abc123", u, id, ok)
+		}
+	}
+}
+
+func TestFetchListForeignShareLink(t *testing.T) {
+	_, err := fetchList("https://example.com/foo/share/abc123")
+	le, ok := err.(*linkError)
+	if !ok || le.Part != "host" {
+		t.Errorf("got %v, want a host error", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -8,27 +9,25 @@ import (
 	"os"
 	"strings"
 	"time"
-	"regexp"
 
 	"github.com/gorilla/sessions"
 	_ "github.com/joho/godotenv/autoload"
-	"github.com/xrash/smetrics"
 	"github.com/zmb3/spotify"
-	"golang.org/x/oauth2"
 )
 
 const (
-	sessionName    = "t2s"
-	errInvalidList = "Dat lijstje lijkt nergens op. Of dat lijkt nergens op 'n lijstje."
-	errSpotifyConn = "Je Spotify account werkt niet echt mee."
-	errSpotifyAuth = "Zonder toestemming kan ik de playlist niet voor je maken."
-	errInternal    = "Er gaat iets mis en het is mijn schuld. :("
+	sessionName         = "t2s"
+	maxTracksPerRequest = 100
+	errInvalidList      = "Dat lijstje lijkt nergens op. Of dat lijkt nergens op 'n lijstje."
+	errSpotifyConn      = "Je Spotify account werkt niet echt mee."
+	errSpotifyAuth      = "Zonder toestemming kan ik de playlist niet voor je maken."
+	errInternal         = "Er gaat iets mis en het is mijn schuld. :("
 )
 
 var (
 	redirectURI = os.Getenv("APP_URL") + "/callback"
-	auth        = spotify.NewAuthenticator(redirectURI, spotify.ScopeUserReadPrivate, spotify.ScopePlaylistModifyPublic)
-	store       = sessions.NewCookieStore([]byte("map[interface{}]interface{}"))
+	auth        = spotify.NewAuthenticator(redirectURI, baseScopes...)
+	store       sessions.Store
 )
 
 func main() {
@@ -39,33 +38,83 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 
-	store.Options.MaxAge = 3200 // little less than 1 hour
+	err = loadNormalizers()
+	if err != nil {
+		panic(err)
+	}
+
+	err = matches.Load()
+	if err != nil {
+		log.Println(err)
+	}
+	go matches.Run(matchCacheSaveInterval)
+
+	err = synced.Load()
+	if err != nil {
+		log.Println(err)
+	}
+	go synced.Run(syncedSaveInterval)
+	go saveOnExit(&matches.jsonFile, &synced.jsonFile)
+
+	store, err = newSessionStore()
+	if err != nil {
+		panic(err)
+	}
+	if fs, ok := store.(*fileSessionStore); ok {
+		go fs.Run(sessionGCInterval)
+	}
+
 	auth.SetAuthInfo(os.Getenv("SPOTIFY_ID"), os.Getenv("SPOTIFY_SECRET"))
 
 	http.HandleFunc("/login", handleLogin)
 	http.HandleFunc("/logout", handleLogout)
 	http.HandleFunc("/callback", handleAuth)
 	http.HandleFunc("/api/me", handlePing)
+	http.HandleFunc("/api/me/export", handleExport)
+	http.HandleFunc("/api/me/forget", handleForget)
 	http.HandleFunc("/api/create-playlist", handleCreatePlaylist)
+	http.HandleFunc("/api/import-playlist", handleImportPlaylist)
+	http.HandleFunc("/api/merge-playlist", handleMergePlaylist)
+	http.HandleFunc("/api/compare", handleCompare)
+	http.HandleFunc("/api/preview", handlePreview)
+	http.HandleFunc("/api/commit-playlist", handleCommitPlaylist)
+	http.HandleFunc("/api/search", handleSearch)
+	http.HandleFunc("/api/add-track", handleAddTrack)
+	http.HandleFunc("/api/jobs/", handleJobEvents)
+	http.HandleFunc("/admin/purge-cache", handlePurgeCache)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web"))))
 	http.HandleFunc("/", handleHome)
-	http.ListenAndServe(":9005", nil)
+	http.ListenAndServe(":9005", secureCookies(http.DefaultServeMux))
 }
 
 func handleHome(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "web/index.html")
 }
 
-func getAuthenticatedClient(r *http.Request) (spotify.Client, error) {
+// getAuthenticatedClient returns a Spotify client for the token in the session.
+// Expired access tokens are refreshed transparently and the rotated token is saved back to the session.
+func getAuthenticatedClient(w http.ResponseWriter, r *http.Request) (spotify.Client, error) {
 	sess, _ := store.Get(r, sessionName)
-	if v, ok := sess.Values["accessToken"]; !ok || sess.IsNew || v.(string) == "" {
+	token, ok := sessionToken(sess)
+	if !ok || sess.IsNew {
 		return spotify.Client{}, errors.New("session is not authenticated with spotify")
 	}
 
-	token := &oauth2.Token{
-		AccessToken: sess.Values["accessToken"].(string),
-	}
 	client := auth.NewClient(token)
+
+	// this refreshes the token if it expired
+	current, err := client.Token()
+	if err != nil {
+		return spotify.Client{}, err
+	}
+
+	if current.AccessToken != token.AccessToken {
+		err = saveSessionToken(w, r, sess, current)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
 	return client, nil
 }
 
@@ -73,7 +122,7 @@ func handlePing(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// get current user
-	client, err := getAuthenticatedClient(r)
+	client, err := getAuthenticatedClient(w, r)
 	if err != nil {
 		w.Write([]byte("false"))
 		return
@@ -96,9 +145,9 @@ func handlePing(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
-
 	var data struct {
 		URL string `json:"url"`
+		playlistOptions
 	}
 	err := json.NewDecoder(r.Body).Decode(&data)
 
@@ -111,63 +160,39 @@ func handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-
-	re := regexp.MustCompile(`\/share\/(\w+)$`)
-	matches := re.FindStringSubmatch(data.URL)
-	if matches == nil || len(matches) < 1 {
-		je.Encode(map[string]interface{}{
-			"error": errInvalidList,
-		})
+	if !checkPlaylistOptions(je, r, &data.playlistOptions) {
 		return
 	}
 
-	id := matches[1]
-	resp, err := http.Get("https://stem-backend.npo.nl/api/form/top-2000/" + id)
+	list, err := fetchList(data.URL)
 	if err != nil {
-		je.Encode(map[string]interface{}{
-			"error": errInvalidList,
-		})
+		writeListError(je, err)
 		return
 	}
-	defer resp.Body.Close()
 
-	var list struct {
-		Name string `json:"name"`
-		Items []struct {
-			ID string `json:"_id"`
-			Source struct {
-				Artist string `json:"artist"`
-				Title string `json:"title"`
-				SpotifyImage string `json:"spotifyImage"`
-			} `json:"_source"`
-		} `json:"shortlist"`
+	logLijstje(r, data.URL)
+	writePlaylist(w, r, list, data.playlistOptions)
+}
 
+// writeListError writes the error for a list that could not be fetched,
+// including which part of the link was not understood if that is known.
+func writeListError(je *json.Encoder, err error) {
+	log.Println(err)
+	res := map[string]interface{}{
+		"error": errInvalidList,
 	}
-	err = json.NewDecoder(resp.Body).Decode(&list)
-	if err != nil {
-		je.Encode(map[string]interface{}{
-			"error": errInvalidList,
-		})
-		return
-	}
-
-	// write lijstje URL to file so we can do stuff later
-	f, err := os.OpenFile("lijstjes.dat", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-	if err == nil {
-		f.WriteString(time.Now().Format("2006-01-02 15:04:05") + " " + data.URL + "\n")
+	if le, ok := err.(*linkError); ok {
+		res["error"] = errInvalidList + " " + le.Hint
+		res["part"] = le.Part
 	}
-	f.Close()
+	je.Encode(res)
+}
 
-	// get client
-	client, err := getAuthenticatedClient(r)
-	if err != nil {
-		log.Println(err)
-		je.Encode(map[string]interface{}{
-			"error": errSpotifyConn,
-		})
-		return
-	}
-	user, err := client.CurrentUser()
+// writePlaylist starts a job creating a playlist for the given list and writes either the job ID or an error to w.
+// Progress of the job can be followed at /api/jobs/{id}/events.
+func writePlaylist(w http.ResponseWriter, r *http.Request, list *List, opts playlistOptions) {
+	je := json.NewEncoder(w)
+	client, err := getAuthenticatedClient(w, r)
 	if err != nil {
 		log.Println(err)
 		je.Encode(map[string]interface{}{
@@ -176,131 +201,174 @@ func handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// create new playlist
-	name := list.Name + "'s Top 2000 lijstje (2019)"
-	playlist, err := client.CreatePlaylistForUser(user.ID, name, true)
-	if err != nil {
-		log.Println(err)
-		je.Encode(map[string]interface{}{
-			"error": errSpotifyConn,
+	userID := sessionUser(r)
+	j := jobs.Start(userID, func(ctx context.Context, j *job) {
+		id, unmatched, err := matchAndCreatePlaylist(ctx, client, userID, list, opts, func(done int, i int, e Entry, ID spotify.ID) {
+			j.Publish(jobEvent{
+				Type:  "progress",
+				Done:  done,
+				Index: i,
+				Total: len(list.Entries),
+				Entry: &e,
+				Track: ID,
+			})
 		})
-		return
-	}
+		if err != nil {
+			j.Finish(jobEvent{Type: "error", Error: err.Error()})
+			return
+		}
 
-	// find all track id's
-	tracks := make([]spotify.ID, 0)
-	for _, track := range list.Items {
-		t := track.Source
+		j.Finish(jobEvent{Type: "done", Playlist: id, Unmatched: unmatched})
+	})
 
-		// lowercase track title
-		ID := searchForTrackID(client, t.Artist, t.Title, t.Artist+" "+t.Title)
-		if ID == "" {
-			ID = searchForTrackID(client, t.Artist, t.Title, t.Artist+" "+t.Title[0:(len(t.Title)/2)])
-		}
+	je.Encode(map[string]string{
+		"job": j.ID,
+	})
+}
 
+// matchAndCreatePlaylist matches every entry of the given list and creates a playlist out of it.
+// If progress is not nil, it is called after every entry with the ID of the matched track, or an empty ID.
+func matchAndCreatePlaylist(ctx context.Context, client spotify.Client, userID string, list *List, opts playlistOptions, progress func(done int, i int, e Entry, ID spotify.ID)) (spotify.ID, []Entry, error) {
+	// find all track id's
+	tracks := make([]spotify.ID, 0)
+	unmatched := make([]Entry, 0)
+	ids, err := matchEntries(ctx, newMatcher(client), userID, list.Entries, progress)
+	if err != nil {
+		log.Println(err)
+		return "", nil, errors.New(errSpotifyBusy)
+	}
+	for i, ID := range ids {
+		t := list.Entries[i]
 		if ID != "" {
 			tracks = append(tracks, ID)
 		} else {
 			log.Printf("failed matching %s %s\n", t.Artist, t.Title)
+			unmatched = append(unmatched, t)
 		}
 	}
 
-
-	_, err = client.AddTracksToPlaylist(user.ID, playlist.ID, tracks...)
-	if err != nil {
+	// do not create a half empty playlist when we ran out of time
+	if err := ctx.Err(); err != nil {
 		log.Println(err)
-		je.Encode(map[string]interface{}{
-			"error": errSpotifyConn,
-		})
-		return
+		return "", nil, errors.New(errInternal)
 	}
 
-	je.Encode(map[string]string{
-		"playlist": playlist.ID.String(),
-	})
+	id, err := createPlaylist(client, list, tracks, opts)
+	return id, unmatched, err
 }
 
-func searchForTrackID(client spotify.Client, artist string, title string, q string) spotify.ID {
-	result, err := client.Search(q, spotify.SearchTypeTrack)
+// createPlaylist creates a new playlist named after the given list, holding the given tracks in order.
+// If the user made a playlist for this list before, that playlist is updated instead.
+// Returned errors are meant to be shown to the user, the underlying error is logged.
+func createPlaylist(client spotify.Client, list *List, tracks []spotify.ID, opts playlistOptions) (spotify.ID, error) {
+	user, err := client.CurrentUser()
 	if err != nil {
 		log.Println(err)
-		return spotify.ID("")
+		return "", errors.New(errSpotifyConn)
 	}
 
-	title = strings.ToLower(title)
-	artist = strings.ToLower(artist)
-
-	// WagnerFischer on all tracks
-	for _, t := range result.Tracks.Tracks {
-		trackMatched := false
-		artistMatched := false
-
-		// normalize track name
-		t.Name = strings.ToLower(t.Name)
-		t.Name = strings.TrimSuffix(t.Name, "remastered")
-		t.Name = strings.TrimSpace(t.Name)
-		t.Name = strings.TrimSuffix(t.Name, "-")
-		t.Name = strings.TrimSpace(t.Name)
+	// unmatched entries are gone by now, so only the tracks we found are ordered
+	ordered, err := orderTracks(client, list.ID, tracks, opts)
+	if err != nil {
+		log.Println(err)
+	} else {
+		tracks = ordered
+	}
 
-		// compare track name
-		if smetrics.WagnerFischer(title, t.Name, 1, 1, 2) <= 5 {
-			trackMatched = true
+	if list.ID != "" {
+		id, ok, err := syncPlaylist(client, user.ID, list, tracks, opts)
+		if err != nil {
+			log.Println(err)
+			return "", errors.New(errSpotifyConn)
 		}
-
-		// compare each track artist
-		for _, a := range t.Artists {
-			a.Name = strings.ToLower(a.Name)
-			if smetrics.WagnerFischer(artist, a.Name, 1, 1, 2) <= 5 {
-				artistMatched = true
-				break
-			}
+		if ok {
+			return id, nil
 		}
+	}
 
-		if trackMatched && artistMatched {
-			return t.ID
+	// create new playlist
+	playlist, err := client.CreatePlaylistForUser(user.ID, playlistName(list, time.Now()), opts.public())
+	if err != nil {
+		log.Println(err)
+		return "", errors.New(errSpotifyConn)
+	}
+
+	if opts.Visibility == visibilityCollaborative {
+		err = changePlaylistAccess(client, playlist.ID, opts)
+		if err != nil {
+			log.Println(err)
+			return "", errors.New(errSpotifyConn)
 		}
 	}
 
-	// String prefix on all track names
-	for _, t := range result.Tracks.Tracks {
-		trackMatched := false
-		artistMatched := false
+	snapshot, err := addTracksToPlaylist(&client, user.ID, playlist.ID, tracks)
+	if err != nil {
+		log.Println(err)
+		return "", errors.New(errSpotifyConn)
+	}
+	if snapshot == "" {
+		snapshot = playlist.SnapshotID
+	}
+
+	if list.ID != "" {
+		synced.Set(user.ID, list.ID, syncedPlaylist{
+			PlaylistID: playlist.ID,
+			SnapshotID: snapshot,
+			Visibility: opts.Visibility,
+			Edition:    list.Edition,
+			Tracks:     tracks,
+		})
+	}
 
-		t.Name = strings.ToLower(t.Name)
+	return playlist.ID, nil
+}
 
-		// search for track name prefix but skip instrumental versions
-		if strings.HasPrefix(t.Name, title) && !strings.Contains(t.Name, "instrumental") {
-			trackMatched = true
+// addTracksToPlaylist adds the given tracks in batches, because Spotify accepts at most 100 tracks per call.
+// It returns the snapshot ID of the playlist after the last batch, or an empty string if there were no tracks.
+func addTracksToPlaylist(client playlistEditor, userID string, playlistID spotify.ID, tracks []spotify.ID) (string, error) {
+	snapshot := ""
+	for len(tracks) > 0 {
+		n := len(tracks)
+		if n > maxTracksPerRequest {
+			n = maxTracksPerRequest
 		}
 
-		// wagnerfischer on artist names
-		for _, a := range t.Artists {
-			a.Name = strings.ToLower(a.Name)
-			if smetrics.WagnerFischer(artist, a.Name, 1, 1, 2) <= 5 {
-				artistMatched = true
-				break
-			}
+		var err error
+		snapshot, err = client.AddTracksToPlaylist(userID, playlistID, tracks[:n]...)
+		if err != nil {
+			return "", err
 		}
 
-		if trackMatched && artistMatched {
-			return t.ID
-		}
+		tracks = tracks[n:]
 	}
 
-	return spotify.ID("")
+	return snapshot, nil
 }
 
 func handleLogin(w http.ResponseWriter, r *http.Request) {
 	sess, _ := store.Get(r, sessionName)
-	url := auth.AuthURL(sess.ID)
+	rememberReturn(sess, r)
+	features := strings.Split(r.URL.Query().Get("scope"), ",")
+	url := loginURL(sess, loginScopes(sess, features))
+	err := sess.Save(r, w)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, errInternal, http.StatusInternalServerError)
+		return
+	}
+
 	http.Redirect(w, r, url, 302)
 }
 
+// handleLogout ends the session. Only a POST also deletes the lijstjes and jobs we keep for the user,
+// so a link on some other site can not make us delete anything but the session.
 func handleLogout(w http.ResponseWriter, r *http.Request) {
-	sess, _ := store.Get(r, sessionName)
-	sess.Options.MaxAge = -1
-	sess.Values["accessToken"] = ""
-	err := sess.Save(r, w)
+	var err error
+	if r.Method == "POST" {
+		_, _, err = forgetUser(w, r)
+	} else {
+		err = endSession(w, r)
+	}
 	if err != nil {
 		log.Println(err)
 		http.Error(w, errInternal, http.StatusInternalServerError)
@@ -313,23 +381,30 @@ func handleLogout(w http.ResponseWriter, r *http.Request) {
 func handleAuth(w http.ResponseWriter, r *http.Request) {
 	sess, _ := store.Get(r, sessionName)
 
-	token, err := auth.Token(sess.ID, r)
+	token, err := loginToken(r, sess)
 	if err != nil {
 		log.Println(err)
+		sess.Save(r, w)
 		http.Error(w, errSpotifyAuth, http.StatusUnauthorized)
 		return
 	}
 
-	// save token
-	//sess.Values["name"] = user.Name
-	sess.Values["accessToken"] = token.AccessToken
-	err = sess.Save(r, w)
+	// save token, along with the Spotify user all server-side data is tied to
+	target := takeReturn(sess)
+	delete(sess.Values, "uid")
+	client := auth.NewClient(token)
+	if user, err := client.CurrentUser(); err == nil {
+		sess.Values["spotifyUser"] = user.ID
+	} else {
+		log.Println(err)
+	}
+	err = saveSessionToken(w, r, sess, token)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, errInternal, http.StatusInternalServerError)
 		return
 	}
 
-	// redirect back to home
-	http.Redirect(w, r, "/", 302)
+	// redirect back to where the user came from
+	http.Redirect(w, r, target, 302)
 }
@@ -0,0 +1,174 @@
+// Package matcher finds the Spotify track belonging to an artist and title.
+//
+// A Matcher returns ranked candidates instead of a single track, each with a
+// confidence score and the reasons it matched. The SearchMatcher combines a
+// Searcher, which talks to Spotify, with any number of strategies that score
+// search results, so both can be swapped out or tested on their own.
+package matcher
+
+import (
+	"context"
+	"sort"
+
+	"github.com/zmb3/spotify"
+)
+
+// Query describes the track we are looking for.
+type Query struct {
+	Artist string
+	Title  string
+}
+
+// Reason is a short code describing why a track was considered a match.
+type Reason string
+
+// Reasons reported by the default queries and strategies.
+const (
+	ReasonTitleDistance  Reason = "title-distance"
+	ReasonTitlePrefix    Reason = "title-prefix"
+	ReasonArtistDistance Reason = "artist-distance"
+	ReasonFallbackQuery  Reason = "fallback-query"
+)
+
+// livePenalty is subtracted from the score of live versions when the query is not for one.
+// Titles are normalized without the live annotation, so otherwise a live version ties with the studio version.
+const livePenalty = 0.1
+
+// Candidate is a track that matched a query, along with a confidence score between 0 and 1.
+type Candidate struct {
+	Track   spotify.FullTrack
+	Score   float64
+	Reasons []Reason
+}
+
+// Matcher finds candidate tracks for a query, best candidate first.
+// An empty slice means nothing matched.
+type Matcher interface {
+	Match(ctx context.Context, q Query) ([]Candidate, error)
+}
+
+// Searcher searches the Spotify catalog for tracks.
+type Searcher interface {
+	SearchTracks(ctx context.Context, q string) ([]spotify.FullTrack, error)
+}
+
+// Strategy scores a single search result for a query.
+// It returns false if the track does not match at all.
+// Titles and artist names of both the query and the track are normalized before they are passed to a strategy.
+type Strategy interface {
+	Score(q Query, t spotify.FullTrack) (float64, []Reason, bool)
+}
+
+// StrategyFunc allows an ordinary function to be used as Strategy.
+type StrategyFunc func(q Query, t spotify.FullTrack) (float64, []Reason, bool)
+
+// Score calls f(q, t).
+func (f StrategyFunc) Score(q Query, t spotify.FullTrack) (float64, []Reason, bool) {
+	return f(q, t)
+}
+
+// SearchMatcher searches for each of its queries in turn and scores all results with its strategies.
+// It stops at the first query that yields candidates.
+type SearchMatcher struct {
+	Searcher   Searcher
+	Strategies []Strategy
+	Queries    []QueryFunc
+
+	TitleNormalizer  Normalizer
+	ArtistNormalizer Normalizer
+}
+
+// QueryFunc builds a search query for q. Returning false skips the query.
+type QueryFunc func(q Query) (string, bool)
+
+// New returns a SearchMatcher with the default queries and strategies.
+func New(s Searcher) *SearchMatcher {
+	return &SearchMatcher{
+		Searcher:         s,
+		Strategies:       DefaultStrategies(),
+		Queries:          DefaultQueries(),
+		TitleNormalizer:  DefaultTitleNormalizer,
+		ArtistNormalizer: DefaultArtistNormalizer,
+	}
+}
+
+// Match implements Matcher.
+func (m *SearchMatcher) Match(ctx context.Context, q Query) ([]Candidate, error) {
+	for i, qf := range m.Queries {
+		s, ok := qf(q)
+		if !ok {
+			continue
+		}
+
+		tracks, err := m.Searcher.SearchTracks(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := m.score(q, tracks)
+		if len(candidates) == 0 {
+			continue
+		}
+
+		if i > 0 {
+			for j := range candidates {
+				candidates[j].Reasons = append(candidates[j].Reasons, ReasonFallbackQuery)
+			}
+		}
+
+		return candidates, nil
+	}
+
+	return []Candidate{}, nil
+}
+
+// score runs all strategies on all tracks and returns the matching tracks, best first.
+// A track is scored by the strategy that likes it best; ties keep the search order.
+func (m *SearchMatcher) score(q Query, tracks []spotify.FullTrack) []Candidate {
+	wantLive := isLive(q.Title)
+	q = Query{
+		Artist: m.ArtistNormalizer.Normalize(q.Artist),
+		Title:  m.TitleNormalizer.Normalize(q.Title),
+	}
+
+	candidates := make([]Candidate, 0)
+	for _, t := range tracks {
+		nt := m.normalizeTrack(t)
+
+		var best *Candidate
+		for _, s := range m.Strategies {
+			score, reasons, ok := s.Score(q, nt)
+			if !ok || (best != nil && score <= best.Score) {
+				continue
+			}
+
+			best = &Candidate{Track: t, Score: score, Reasons: reasons}
+		}
+
+		if best != nil {
+			if !wantLive && isLive(t.Name) {
+				best.Score -= livePenalty
+			}
+			candidates = append(candidates, *best)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	return candidates
+}
+
+// normalizeTrack returns a copy of t with a normalized name and artist names.
+func (m *SearchMatcher) normalizeTrack(t spotify.FullTrack) spotify.FullTrack {
+	artists := make([]spotify.SimpleArtist, len(t.Artists))
+	for i, a := range t.Artists {
+		a.Name = m.ArtistNormalizer.Normalize(a.Name)
+		artists[i] = a
+	}
+
+	t.Name = m.TitleNormalizer.Normalize(t.Name)
+	t.Artists = artists
+	return t
+}
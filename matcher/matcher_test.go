@@ -0,0 +1,161 @@
+package matcher
+
+import (
+	"context"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/zmb3/spotify"
+)
+
+// fakeSearcher returns canned results per query and remembers what was searched for.
+type fakeSearcher struct {
+	results map[string][]spotify.FullTrack
+	queries []string
+}
+
+func (s *fakeSearcher) SearchTracks(ctx context.Context, q string) ([]spotify.FullTrack, error) {
+	s.queries = append(s.queries, q)
+	return s.results[q], nil
+}
+
+func track(id, artist, title string) spotify.FullTrack {
+	t := spotify.FullTrack{}
+	t.ID = spotify.ID(id)
+	t.Name = title
+	t.Artists = []spotify.SimpleArtist{{Name: artist}}
+	return t
+}
+
+func hasReason(c Candidate, r Reason) bool {
+	for _, reason := range c.Reasons {
+		if reason == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMatchRanksDistanceAbovePrefix(t *testing.T) {
+	s := &fakeSearcher{results: map[string][]spotify.FullTrack{
+		"Queen Bohemian Rhapsody": {
+			track("karaoke", "Queen", "Bohemian Rhapsody Karaoke Version"),
+			track("instrumental", "Queen", "Bohemian Rhapsody Instrumental Version"),
+			track("other", "Queen", "We Will Rock You"),
+			track("cover", "Panic! At The Disco", "Bohemian Rhapsody"),
+			track("studio", "Queen", "Bohemian Rhapsody - Remastered 2011"),
+		},
+	}}
+
+	candidates, err := New(s).Match(context.Background(), Query{Artist: "Queen", Title: "Bohemian Rhapsody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2: %+v", len(candidates), candidates)
+	}
+
+	if c := candidates[0]; c.Track.ID != "studio" || c.Score != 1 || !hasReason(c, ReasonTitleDistance) {
+		t.Errorf("got best candidate %s with score %v and reasons %v, want the studio version by distance", c.Track.ID, c.Score, c.Reasons)
+	}
+	if c := candidates[1]; c.Track.ID != "karaoke" || c.Score > 0.5 || !hasReason(c, ReasonTitlePrefix) {
+		t.Errorf("got second candidate %s with score %v and reasons %v, want the karaoke version by prefix", c.Track.ID, c.Score, c.Reasons)
+	}
+	for _, c := range candidates {
+		if hasReason(c, ReasonFallbackQuery) {
+			t.Errorf("candidate %s found by the first query has reason %s", c.Track.ID, ReasonFallbackQuery)
+		}
+	}
+}
+
+func TestMatchFallbackQuery(t *testing.T) {
+	s := &fakeSearcher{results: map[string][]spotify.FullTrack{
+		"De Dijk Als Het Golft": {
+			track("wrong", "De Dijk", "Mag Het Licht Uit"),
+		},
+		"De Dijk Als He": {
+			track("right", "De Dijk", "Als Het Golft"),
+		},
+	}}
+
+	candidates, err := New(s).Match(context.Background(), Query{Artist: "De Dijk", Title: "Als Het Golft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.queries) != 2 || s.queries[1] != "De Dijk Als He" {
+		t.Errorf("got queries %q, want the full title followed by half of it", s.queries)
+	}
+	if len(candidates) != 1 || candidates[0].Track.ID != "right" || !hasReason(candidates[0], ReasonFallbackQuery) {
+		t.Errorf("got %+v, want the track found by the fallback query", candidates)
+	}
+}
+
+func TestMatchNoCandidates(t *testing.T) {
+	s := &fakeSearcher{}
+
+	candidates, err := New(s).Match(context.Background(), Query{Artist: "Queen", Title: "Bohemian Rhapsody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if candidates == nil || len(candidates) != 0 {
+		t.Errorf("got %+v, want an empty slice", candidates)
+	}
+}
+
+func TestDefaultQueriesHalfTitleIsRuneSafe(t *testing.T) {
+	half := DefaultQueries()[1]
+
+	tests := []struct {
+		q    Query
+		want string
+		ok   bool
+	}{
+		{Query{Artist: "Peggy Lee", Title: "Mañana"}, "Peggy Lee Mañ", true},
+		{Query{Artist: "Stromae", Title: "Alors On Danse"}, "Stromae Alors O", true},
+		{Query{Artist: "Björk", Title: "Ö"}, "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := half(test.q)
+		if got != test.want || ok != test.ok {
+			t.Errorf("half title query for %+v = %q, %v, want %q, %v", test.q, got, ok, test.want, test.ok)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("half title query for %+v is not valid UTF-8: %q", test.q, got)
+		}
+	}
+}
+
+func TestMatchPrefersStudioOverLive(t *testing.T) {
+	s := &fakeSearcher{results: map[string][]spotify.FullTrack{
+		"Eagles Hotel California": {
+			track("live", "Eagles", "Hotel California - Live On MTV, 1994"),
+			track("studio", "Eagles", "Hotel California - 2013 Remaster"),
+		},
+		"Eagles Hotel California (Live)": {
+			track("studio", "Eagles", "Hotel California - 2013 Remaster"),
+			track("live", "Eagles", "Hotel California - Live On MTV, 1994"),
+		},
+	}}
+	m := New(s)
+
+	candidates, err := m.Match(context.Background(), Query{Artist: "Eagles", Title: "Hotel California"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].Track.ID != "studio" || candidates[0].Score <= candidates[1].Score {
+		t.Errorf("got %+v, want the studio version ranked above the live version", candidates)
+	}
+
+	candidates, err = m.Match(context.Background(), Query{Artist: "Eagles", Title: "Hotel California (Live)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].Score != candidates[1].Score {
+		t.Errorf("got %+v, want the live and studio version to tie when asking for a live version", candidates)
+	}
+}
@@ -0,0 +1,175 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Rule transforms a string as one step of a normalization pipeline.
+type Rule func(s string) string
+
+// Normalizer applies its rules in order. Rules expect a lowercase string, so Lowercase usually comes first.
+type Normalizer []Rule
+
+// Normalize runs s through all rules.
+func (n Normalizer) Normalize(s string) string {
+	for _, r := range n {
+		s = r(s)
+	}
+
+	return s
+}
+
+var (
+	// DefaultTitleNormalizer is used for track titles on both the list and the Spotify side.
+	DefaultTitleNormalizer = Normalizer{Lowercase, FoldDiacritics, StripRemaster, StripLive, StripFeaturing, ReplaceAmpersand, StripPunctuation, CollapseSpace}
+
+	// DefaultArtistNormalizer is used for artist names on both the list and the Spotify side.
+	DefaultArtistNormalizer = Normalizer{Lowercase, FoldDiacritics, StripFeaturing, ReplaceAmpersand, StripPunctuation, StripLeadingThe, CollapseSpace}
+)
+
+// rules holds all rules by name, for building a Normalizer from configuration.
+var rules = map[string]Rule{
+	"lowercase":   Lowercase,
+	"diacritics":  FoldDiacritics,
+	"remaster":    StripRemaster,
+	"live":        StripLive,
+	"featuring":   StripFeaturing,
+	"ampersand":   ReplaceAmpersand,
+	"punctuation": StripPunctuation,
+	"the":         StripLeadingThe,
+	"space":       CollapseSpace,
+}
+
+// NewNormalizer builds a Normalizer from rule names, for example "lowercase,diacritics,space".
+func NewNormalizer(names string) (Normalizer, error) {
+	n := make(Normalizer, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		r, ok := rules[name]
+		if !ok {
+			return nil, fmt.Errorf("matcher: unknown normalization rule %q", name)
+		}
+		n = append(n, r)
+	}
+
+	return n, nil
+}
+
+var (
+	remasterSuffix      = regexp.MustCompile(`\s*[-–—]\s*(\d{4}\s+)?(digital(ly)?\s+)?remaster(ed)?(\s+(version|\d{4}))*\s*$`)
+	remasterParenthesis = regexp.MustCompile(`\s*[(\[][^)\]]*remaster[^)\]]*[)\]]`)
+	remasterTrailing    = regexp.MustCompile(`\s+remastered\s*$`)
+	liveSuffix          = regexp.MustCompile(`\s*[-–—]\s*live\b.*$`)
+	liveParenthesis     = regexp.MustCompile(`\s*[(\[]\s*live\b[^)\]]*[)\]]`)
+	featParenthesis     = regexp.MustCompile(`\s*[(\[]\s*(feat|ft|featuring)\b[^)\]]*[)\]]`)
+	featTrailing        = regexp.MustCompile(`\s+(feat|ft|featuring)\b.*$`)
+	leadingThe          = regexp.MustCompile(`^the\s+`)
+)
+
+// Lowercase lowercases s.
+func Lowercase(s string) string {
+	return strings.ToLower(s)
+}
+
+// diacritics maps accented latin letters to their plain counterpart.
+var diacritics = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i", 'į': "i",
+	'ł': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s",
+	'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ĳ': "ij",
+}
+
+// FoldDiacritics replaces accented letters by their plain counterpart, so "André" matches "Andre".
+// It expects lowercase input.
+func FoldDiacritics(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		if plain, ok := diacritics[r]; ok {
+			b.WriteString(plain)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// StripRemaster removes remaster annotations like "- Remastered 2011", "(2009 Remaster)" or a trailing "remastered".
+func StripRemaster(s string) string {
+	s = remasterParenthesis.ReplaceAllString(s, "")
+	s = remasterSuffix.ReplaceAllString(s, "")
+	s = remasterTrailing.ReplaceAllString(s, "")
+	return s
+}
+
+// StripLive removes live annotations like "- Live at Wembley" or "(Live)".
+func StripLive(s string) string {
+	s = liveParenthesis.ReplaceAllString(s, "")
+	s = liveSuffix.ReplaceAllString(s, "")
+	return s
+}
+
+// isLive reports whether title has a live annotation StripLive would remove.
+func isLive(title string) bool {
+	title = strings.ToLower(title)
+	return liveParenthesis.MatchString(title) || liveSuffix.MatchString(title)
+}
+
+// StripFeaturing removes featured artists, both "(feat. X)" and a trailing "ft. X".
+func StripFeaturing(s string) string {
+	s = featParenthesis.ReplaceAllString(s, "")
+	s = featTrailing.ReplaceAllString(s, "")
+	return s
+}
+
+// ReplaceAmpersand spells out "&" and "+" as "and", so "Simon & Garfunkel" matches "Simon and Garfunkel".
+func ReplaceAmpersand(s string) string {
+	return strings.NewReplacer("&", " and ", "+", " and ").Replace(s)
+}
+
+// StripPunctuation removes apostrophes and replaces all other characters that are not letters or digits with a space.
+func StripPunctuation(s string) string {
+	var b bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '\'' || r == '’' || r == '`' || r == '´':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	return b.String()
+}
+
+// StripLeadingThe removes a leading "the ", so "The Beatles" matches "Beatles".
+func StripLeadingThe(s string) string {
+	return leadingThe.ReplaceAllString(strings.TrimSpace(s), "")
+}
+
+// CollapseSpace trims s and replaces all runs of whitespace with a single space.
+func CollapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
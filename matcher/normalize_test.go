@@ -0,0 +1,64 @@
+package matcher
+
+import "testing"
+
+func TestDefaultTitleNormalizer(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Bohemian Rhapsody - Remastered 2011", "bohemian rhapsody"},
+		{"Wish You Were Here (2009 Remaster)", "wish you were here"},
+		{"Hotel California - 2013 Remaster", "hotel california"},
+		{"Stairway To Heaven - Remaster", "stairway to heaven"},
+		{"Avond - Live", "avond"},
+		{"Zij Gelooft In Mij (Live)", "zij gelooft in mij"},
+		{"Dat Ik Je Mis (feat. Glennis Grace)", "dat ik je mis"},
+		{"Shallow ft. Bradley Cooper", "shallow"},
+		{"Rock & Roll", "rock and roll"},
+		{"Don't Stop Me Now", "dont stop me now"},
+		{"Één Vogel  Kan De  Lente", "een vogel kan de lente"},
+	}
+
+	for _, test := range tests {
+		if got := DefaultTitleNormalizer.Normalize(test.in); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestDefaultArtistNormalizer(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"André Hazes", "andre hazes"},
+		{"Boudewijn de Groot", "boudewijn de groot"},
+		{"The Beatles", "beatles"},
+		{"Theo Maassen", "theo maassen"},
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"Simon and Garfunkel", "simon and garfunkel"},
+		{"Ronnie Flex feat. Frenna", "ronnie flex"},
+		{"Guns N' Roses", "guns n roses"},
+	}
+
+	for _, test := range tests {
+		if got := DefaultArtistNormalizer.Normalize(test.in); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestNewNormalizer(t *testing.T) {
+	n, err := NewNormalizer("lowercase, diacritics,space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Normalize(" André  Hazes "); got != "andre hazes" {
+		t.Errorf("got %q, want %q", got, "andre hazes")
+	}
+
+	if _, err := NewNormalizer("lowercase,nonsense"); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
@@ -0,0 +1,83 @@
+package matcher
+
+import (
+	"strings"
+
+	"github.com/xrash/smetrics"
+	"github.com/zmb3/spotify"
+)
+
+// maxDistance is the highest Wagner-Fischer distance still considered a match.
+const maxDistance = 5
+
+// DefaultQueries searches for "artist title" first and falls back to the artist with the first half of the title,
+// which helps for titles that Spotify spells very differently.
+func DefaultQueries() []QueryFunc {
+	return []QueryFunc{
+		func(q Query) (string, bool) {
+			return q.Artist + " " + q.Title, true
+		},
+		func(q Query) (string, bool) {
+			title := []rune(q.Title)
+			if len(title) < 2 {
+				return "", false
+			}
+
+			return q.Artist + " " + string(title[:len(title)/2]), true
+		},
+	}
+}
+
+// DefaultStrategies returns the distance strategy followed by the prefix strategy.
+func DefaultStrategies() []Strategy {
+	return []Strategy{
+		StrategyFunc(DistanceStrategy),
+		StrategyFunc(PrefixStrategy),
+	}
+}
+
+// DistanceStrategy matches tracks whose title and one of whose artists are within a small edit distance.
+// It scores between 0.5 and 1, depending on how close both are.
+func DistanceStrategy(q Query, t spotify.FullTrack) (float64, []Reason, bool) {
+	titleDist := smetrics.WagnerFischer(q.Title, t.Name, 1, 1, 2)
+	if titleDist > maxDistance {
+		return 0, nil, false
+	}
+
+	artistDist, ok := artistDistance(q.Artist, t.Artists)
+	if !ok {
+		return 0, nil, false
+	}
+
+	score := 1 - float64(titleDist+artistDist)/float64(4*maxDistance)
+	return score, []Reason{ReasonTitleDistance, ReasonArtistDistance}, true
+}
+
+// PrefixStrategy matches tracks whose title starts with the title we are looking for, skipping instrumental versions.
+// It scores between 0.25 and 0.5, so it never beats a DistanceStrategy match.
+func PrefixStrategy(q Query, t spotify.FullTrack) (float64, []Reason, bool) {
+	if q.Title == "" || !strings.HasPrefix(t.Name, q.Title) || strings.Contains(t.Name, "instrumental") {
+		return 0, nil, false
+	}
+
+	artistDist, ok := artistDistance(q.Artist, t.Artists)
+	if !ok {
+		return 0, nil, false
+	}
+
+	score := 0.5 - float64(artistDist)/float64(4*maxDistance)
+	return score, []Reason{ReasonTitlePrefix, ReasonArtistDistance}, true
+}
+
+// artistDistance returns the smallest edit distance between artist and any of the track artists.
+func artistDistance(artist string, artists []spotify.SimpleArtist) (int, bool) {
+	best := -1
+	for _, a := range artists {
+		d := smetrics.WagnerFischer(artist, a.Name, 1, 1, 2)
+		if d <= maxDistance && (best < 0 || d < best) {
+			best = d
+		}
+	}
+
+	return best, best >= 0
+}
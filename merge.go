@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	maxMergeLists = 50
+	errMergeLists = "Geef minstens twee lijstjes op om samen te voegen."
+)
+
+// mergedEntry is an entry of a merged list, along with the number of lists it appeared on.
+type mergedEntry struct {
+	Entry
+	Votes int
+}
+
+// handleMergePlaylist creates one playlist out of several lijstjes, ordered by the number of lists each track is on.
+func handleMergePlaylist(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Name string   `json:"name"`
+		URLs []string `json:"urls"`
+		playlistOptions
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if err != nil || len(data.URLs) < 2 || len(data.URLs) > maxMergeLists {
+		je.Encode(map[string]interface{}{
+			"error": errMergeLists,
+		})
+		return
+	}
+	if !checkPlaylistOptions(je, r, &data.playlistOptions) {
+		return
+	}
+
+	lists := make([]*List, 0, len(data.URLs))
+	for _, url := range data.URLs {
+		list, err := fetchList(url)
+		if err != nil {
+			writeListError(je, err)
+			return
+		}
+
+		logLijstje(r, url)
+		lists = append(lists, list)
+	}
+
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		name = "Team"
+	}
+
+	merged := &List{
+		Name:    name,
+		Title:   lists[0].Title,
+		Edition: lists[0].Edition,
+	}
+	for _, e := range mergeLists(lists) {
+		merged.Entries = append(merged.Entries, e.Entry)
+	}
+
+	writePlaylist(w, r, merged, data.playlistOptions)
+}
+
+// mergeLists deduplicates the entries of all given lists and ranks them by the number of lists containing them.
+// Entries are the same when they share a catalog ID or the same normalized artist and title.
+// Ties keep the order in which entries were first seen.
+func mergeLists(lists []*List) []*mergedEntry {
+	merged := make([]*mergedEntry, 0)
+	index := make(map[string]*mergedEntry)
+
+	for _, list := range lists {
+		// a track counts once per list, even if someone managed to add it twice
+		seen := make(map[*mergedEntry]bool)
+
+		for _, e := range list.Entries {
+			keys := entryKeys(e)
+
+			var m *mergedEntry
+			for _, k := range keys {
+				if m = index[k]; m != nil {
+					break
+				}
+			}
+
+			if m == nil {
+				m = &mergedEntry{Entry: e}
+				merged = append(merged, m)
+			}
+
+			for _, k := range keys {
+				index[k] = m
+			}
+
+			if !seen[m] {
+				seen[m] = true
+				m.Votes++
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Votes > merged[j].Votes
+	})
+
+	return merged
+}
+
+// entryKeys returns the keys under which an entry can be recognized across lists.
+func entryKeys(e Entry) []string {
+	keys := make([]string, 0, 2)
+	if e.CatalogID != "" {
+		keys = append(keys, "id:"+e.CatalogID)
+	}
+
+	return append(keys, "track:"+artistNormalizer.Normalize(e.Artist)+"|"+titleNormalizer.Normalize(e.Title))
+}
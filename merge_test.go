@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestMergeLists(t *testing.T) {
+	lists := []*List{
+		{Entries: []Entry{
+			{Artist: "Queen", Title: "Bohemian Rhapsody", CatalogID: "q1"},
+			{Artist: "Eagles", Title: "Hotel California"},
+		}},
+		{Entries: []Entry{
+			{Artist: "QUEEN", Title: "Bohemian Rhapsody - Remastered 2011"},
+			{Artist: "André Hazes", Title: "Zij Gelooft In Mij", CatalogID: "h1"},
+			{Artist: "Andre Hazes", Title: "Zij gelooft in mij"},
+		}},
+		{Entries: []Entry{
+			{Artist: "Hazes", Title: "Zij Gelooft", CatalogID: "h1"},
+			{Artist: "The Eagles", Title: "Hotel California"},
+			{Artist: "Queen", Title: "Bohemian Rhapsody", CatalogID: "q1"},
+			{Artist: "Boudewijn de Groot", Title: "Avond"},
+		}},
+	}
+
+	want := []struct {
+		artist string
+		votes  int
+	}{
+		{"Queen", 3},
+		{"Eagles", 2},
+		{"André Hazes", 2},
+		{"Boudewijn de Groot", 1},
+	}
+
+	got := mergeLists(lists)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Artist != w.artist || got[i].Votes != w.votes {
+			t.Errorf("entry %d = %s with %d votes, want %s with %d votes", i, got[i].Artist, got[i].Votes, w.artist, w.votes)
+		}
+	}
+}
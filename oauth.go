@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+// maxPendingURL is the longest list URL we carry through a login.
+const maxPendingURL = 2048
+
+// tokenClient is used for exchanging authorization codes ourselves, when PKCE is enabled.
+var tokenClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// usePKCE reports whether logins should use PKCE on top of the client secret, enabled by OAUTH_PKCE=true.
+func usePKCE() bool {
+	return os.Getenv("OAUTH_PKCE") == "true"
+}
+
+// newNonce returns a random, URL safe string of 43 characters, suitable as OAuth state and PKCE code verifier.
+func newNonce() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// loginURL starts a new login asking for the given scopes: it stores a fresh state (and code verifier) in the session
+// and returns the URL to send the user to. The session still has to be saved.
+func loginURL(sess *sessions.Session, scopes []string) string {
+	state := newNonce()
+	sess.Values["oauthState"] = state
+	sess.Values["oauthScopes"] = strings.Join(scopes, " ")
+	delete(sess.Values, "oauthVerifier")
+
+	u := authenticatorFor(scopes).AuthURL(state)
+	if usePKCE() {
+		verifier := newNonce()
+		sess.Values["oauthVerifier"] = verifier
+
+		sum := sha256.Sum256([]byte(verifier))
+		u += "&" + url.Values{
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+			"code_challenge_method": {"S256"},
+		}.Encode()
+	}
+
+	return u
+}
+
+// loginToken finishes a login started by loginURL: it checks the state Spotify sent back against the one in the session
+// and exchanges the code for a token. The state is removed from the session either way, so it can only be used once.
+// The scopes the user granted are stored in the session.
+func loginToken(r *http.Request, sess *sessions.Session) (*oauth2.Token, error) {
+	state, _ := sess.Values["oauthState"].(string)
+	verifier, _ := sess.Values["oauthVerifier"].(string)
+	requested, _ := sess.Values["oauthScopes"].(string)
+	delete(sess.Values, "oauthState")
+	delete(sess.Values, "oauthVerifier")
+	delete(sess.Values, "oauthScopes")
+
+	if state == "" {
+		return nil, errors.New("oauth: no login in progress")
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("state")), []byte(state)) != 1 {
+		return nil, errors.New("oauth: redirect state parameter doesn't match")
+	}
+
+	var token *oauth2.Token
+	var err error
+	if verifier == "" {
+		token, err = auth.Token(state, r)
+	} else {
+		token, err = codeToken(r, verifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Spotify tells which scopes were granted, fall back to the ones we asked for if it does not
+	granted, _ := token.Extra("scope").(string)
+	if granted == "" {
+		granted = requested
+	}
+	sess.Values["scopes"] = strings.Join(uniqueScopes(strings.Fields(granted)), " ")
+
+	return token, nil
+}
+
+// codeToken exchanges the code in the callback request using PKCE.
+func codeToken(r *http.Request, verifier string) (*oauth2.Token, error) {
+	values := r.URL.Query()
+	if e := values.Get("error"); e != "" {
+		return nil, errors.New("oauth: auth failed - " + e)
+	}
+	code := values.Get("code")
+	if code == "" {
+		return nil, errors.New("oauth: didn't get access code")
+	}
+
+	return exchangePKCE(code, verifier)
+}
+
+// exchangePKCE exchanges an authorization code along with its code verifier,
+// which spotify.Authenticator can not do as it does not accept extra parameters.
+func exchangePKCE(code string, verifier string) (*oauth2.Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+		"client_id":     {os.Getenv("SPOTIFY_ID")},
+	}
+
+	req, err := http.NewRequest("POST", spotify.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret := os.Getenv("SPOTIFY_SECRET"); secret != "" {
+		req.SetBasicAuth(os.Getenv("SPOTIFY_ID"), secret)
+	}
+
+	res, err := tokenClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var data struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		Error        string `json:"error"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK || data.AccessToken == "" {
+		return nil, fmt.Errorf("oauth: token exchange failed with status %d: %s", res.StatusCode, data.Error)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  data.AccessToken,
+		TokenType:    data.TokenType,
+		RefreshToken: data.RefreshToken,
+	}
+	if data.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(data.ExpiresIn) * time.Second)
+	}
+
+	return token.WithExtra(map[string]interface{}{"scope": data.Scope}), nil
+}
+
+// rememberReturn stores where to send the user after logging in, from the "return" and "url" query parameters of /login.
+// "url" is the list URL the user pasted before logging in, so we can pick up where they left off.
+func rememberReturn(sess *sessions.Session, r *http.Request) {
+	sess.Values["returnTo"] = safeReturnPath(r.URL.Query().Get("return"))
+
+	pending := strings.TrimSpace(r.URL.Query().Get("url"))
+	if pending != "" && len(pending) <= maxPendingURL {
+		sess.Values["pendingURL"] = pending
+	} else {
+		delete(sess.Values, "pendingURL")
+	}
+}
+
+// takeReturn removes the return target from the session and returns the URL to redirect to after logging in.
+// A pending list URL is passed along as the "url" query parameter, so the form is filled in again.
+// The user still has to submit it: any site can link to /login and Spotify skips its dialog for users who
+// approved us before, so creating the playlist right away would let other sites create playlists for them.
+func takeReturn(sess *sessions.Session) string {
+	target, _ := sess.Values["returnTo"].(string)
+	pending, _ := sess.Values["pendingURL"].(string)
+	delete(sess.Values, "returnTo")
+	delete(sess.Values, "pendingURL")
+
+	target = safeReturnPath(target)
+	if pending == "" {
+		return target
+	}
+
+	u, _ := url.Parse(target)
+	q := u.Query()
+	q.Set("url", pending)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// safeReturnPath returns p if it is a path on this site and "/" otherwise,
+// so /login can not be abused to redirect users to some other site.
+func safeReturnPath(p string) string {
+	if p == "" || p[0] != '/' || strings.HasPrefix(p, "//") || strings.ContainsAny(p, "\\\r\n\t") {
+		return "/"
+	}
+
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "/"
+	}
+
+	u.Fragment = ""
+	return u.String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestReturnRefillsPendingList(t *testing.T) {
+	store = sessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+
+	r := httptest.NewRequest("GET", "/login?return=/&url=https://stem.nporadio2.nl/top-2000/share/abc123", nil)
+	sess, _ := store.Get(r, sessionName)
+	rememberReturn(sess, r)
+
+	// the form is filled in again, but nothing may make the page create the playlist by itself
+	target, err := url.Parse(takeReturn(sess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Path != "/" || target.Query().Get("url") != "https://stem.nporadio2.nl/top-2000/share/abc123" {
+		t.Errorf("got redirect %q, want / with the pasted lijstje", target)
+	}
+	if len(target.Query()) != 1 {
+		t.Errorf("got redirect %q, want nothing but the pasted lijstje", target)
+	}
+
+	if _, ok := sess.Values["pendingURL"]; ok {
+		t.Error("pending lijstje is still in the session after returning")
+	}
+	if target := takeReturn(sess); target != "/" {
+		t.Errorf("got redirect %q the second time, want /", target)
+	}
+}
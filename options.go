@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+const errInvalidOptions = "Zo'n playlist kan ik niet voor je maken."
+
+const (
+	visibilityPublic        = "public"
+	visibilityPrivate       = "private"
+	visibilityCollaborative = "collaborative"
+)
+
+// playlistsURL is the Spotify endpoint for changing playlists the client library has no call for.
+const playlistsURL = "https://api.spotify.com/v1/playlists/"
+
+// playlistOptions are the choices a user has when creating a playlist. They are embedded in the body of every request creating one.
+type playlistOptions struct {
+	// Visibility is one of "public" (the default), "private" or "collaborative".
+	Visibility string `json:"visibility"`
+
+	// Order is one of "list" (the default), "year", "artist", "popularity" or "shuffle".
+	Order string `json:"order"`
+
+	// Seed makes a shuffle repeatable. When it is zero, the seed is derived from the list, see shuffleSeed.
+	Seed int64 `json:"seed"`
+}
+
+// public reports whether the playlist should be public.
+func (o playlistOptions) public() bool {
+	return o.Visibility == "" || o.Visibility == visibilityPublic
+}
+
+// features returns the optional features, see featureScopes, needed for these options.
+func (o playlistOptions) features() []string {
+	switch o.Visibility {
+	case visibilityPrivate:
+		return []string{"private"}
+	case visibilityCollaborative:
+		return []string{"collaborative"}
+	}
+
+	return nil
+}
+
+// checkPlaylistOptions fills in defaults and checks whether the user granted the scopes needed for opts.
+// If opts are invalid or scopes are missing, it writes an error and returns false.
+func checkPlaylistOptions(je *json.Encoder, r *http.Request, opts *playlistOptions) bool {
+	switch opts.Visibility {
+	case "":
+		opts.Visibility = visibilityPublic
+	case visibilityPublic, visibilityPrivate, visibilityCollaborative:
+	default:
+		je.Encode(map[string]interface{}{
+			"error": errInvalidOptions,
+		})
+		return false
+	}
+
+	switch opts.Order {
+	case "":
+		opts.Order = orderList
+	case orderList, orderYear, orderArtist, orderPopularity, orderShuffle:
+	default:
+		je.Encode(map[string]interface{}{
+			"error": errInvalidOptions,
+		})
+		return false
+	}
+
+	return checkScopes(je, r, opts.features()...)
+}
+
+// changePlaylistAccess makes a playlist public, private or collaborative, so everyone the user shares it with can add tracks.
+// The client library only knows about public and private, so this is ChangePlaylistAccess with the collaborative flag.
+func changePlaylistAccess(client spotify.Client, playlistID spotify.ID, opts playlistOptions) error {
+	token, err := client.Token()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]bool{
+		"public":        opts.public(),
+		"collaborative": opts.Visibility == visibilityCollaborative,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", playlistsURL+string(playlistID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(token)).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("spotify: changing access of playlist %s failed with status %d", playlistID, res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	orderList       = "list"
+	orderYear       = "year"
+	orderArtist     = "artist"
+	orderPopularity = "popularity"
+	orderShuffle    = "shuffle"
+
+	// maxTracksPerLookup and maxAlbumsPerLookup are the most tracks and albums Spotify returns in a single call.
+	maxTracksPerLookup = 50
+	maxAlbumsPerLookup = 20
+)
+
+// orderTracks returns the matched tracks of the list with the given ID in the order asked for in opts.
+// Tracks that compare equal keep their list order.
+func orderTracks(client spotify.Client, listID string, tracks []spotify.ID, opts playlistOptions) ([]spotify.ID, error) {
+	ordered := append([]spotify.ID{}, tracks...)
+
+	switch opts.Order {
+	case orderShuffle:
+		for i, j := range rand.New(rand.NewSource(shuffleSeed(listID, opts))).Perm(len(tracks)) {
+			ordered[i] = tracks[j]
+		}
+		return ordered, nil
+
+	case orderYear, orderArtist, orderPopularity:
+		// handled below, these need the details of every track
+
+	default:
+		return ordered, nil
+	}
+
+	details, err := lookupTracks(client, tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Order {
+	case orderYear:
+		years, err := releaseYears(client, details)
+		if err != nil {
+			return nil, err
+		}
+
+		// tracks without a known year go last
+		sort.SliceStable(ordered, func(i, j int) bool {
+			a, b := years[ordered[i]], years[ordered[j]]
+			return a != 0 && (b == 0 || a < b)
+		})
+
+	case orderArtist:
+		artists := make(map[spotify.ID]string, len(details))
+		for id, t := range details {
+			if len(t.Artists) > 0 {
+				artists[id] = artistNormalizer.Normalize(t.Artists[0].Name)
+			}
+		}
+
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return artists[ordered[i]] < artists[ordered[j]]
+		})
+
+	case orderPopularity:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return popularity(details, ordered[i]) > popularity(details, ordered[j])
+		})
+	}
+
+	return ordered, nil
+}
+
+// shuffleSeed returns the seed to shuffle the list with. Without a seed in opts it is derived from the list ID,
+// so resubmitting a list gives the same shuffle and its synced playlist is not reordered all over again.
+// Only lists without an ID get a new shuffle every time.
+func shuffleSeed(listID string, opts playlistOptions) int64 {
+	if opts.Seed != 0 {
+		return opts.Seed
+	}
+	if listID == "" {
+		return time.Now().UnixNano()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(listID))
+	return int64(h.Sum64())
+}
+
+// lookupTracks fetches the details of all given tracks, in batches.
+func lookupTracks(client spotify.Client, tracks []spotify.ID) (map[spotify.ID]*spotify.FullTrack, error) {
+	details := make(map[spotify.ID]*spotify.FullTrack, len(tracks))
+	for start := 0; start < len(tracks); start += maxTracksPerLookup {
+		end := start + maxTracksPerLookup
+		if end > len(tracks) {
+			end = len(tracks)
+		}
+
+		found, err := client.GetTracks(tracks[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range found {
+			if t != nil {
+				details[t.ID] = t
+			}
+		}
+	}
+
+	return details, nil
+}
+
+// releaseYears returns the year the album of every track was released.
+// Tracks only know their album by name, so the albums are fetched in batches as well.
+func releaseYears(client spotify.Client, details map[spotify.ID]*spotify.FullTrack) (map[spotify.ID]int, error) {
+	seen := make(map[spotify.ID]bool)
+	albums := make([]spotify.ID, 0)
+	for _, t := range details {
+		if t.Album.ID != "" && !seen[t.Album.ID] {
+			seen[t.Album.ID] = true
+			albums = append(albums, t.Album.ID)
+		}
+	}
+
+	albumYears := make(map[spotify.ID]int, len(albums))
+	for start := 0; start < len(albums); start += maxAlbumsPerLookup {
+		end := start + maxAlbumsPerLookup
+		if end > len(albums) {
+			end = len(albums)
+		}
+
+		found, err := client.GetAlbums(albums[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range found {
+			if a == nil || len(a.ReleaseDate) < 4 {
+				continue
+			}
+
+			// release dates are "1981", "1981-12" or "1981-12-24"
+			if year, err := strconv.Atoi(a.ReleaseDate[:4]); err == nil {
+				albumYears[a.ID] = year
+			}
+		}
+	}
+
+	years := make(map[spotify.ID]int, len(details))
+	for id, t := range details {
+		years[id] = albumYears[t.Album.ID]
+	}
+
+	return years, nil
+}
+
+func popularity(details map[spotify.ID]*spotify.FullTrack, id spotify.ID) int {
+	if t, ok := details[id]; ok {
+		return t.Popularity
+	}
+
+	return -1
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestShuffleIsRepeatable(t *testing.T) {
+	tracks := []spotify.ID{"a", "b", "c", "d", "e", "f", "g", "h"}
+	shuffle := func(listID string, seed int64) []spotify.ID {
+		// the client is only used to look up tracks, which shuffling does not need
+		ordered, err := orderTracks(spotify.Client{}, listID, tracks, playlistOptions{Order: orderShuffle, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ordered
+	}
+
+	if got, want := shuffle("final-2024", 0), shuffle("final-2024", 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v after resubmitting the list, want %v", got, want)
+	}
+	if got, want := shuffle("final-2024", 42), shuffle("other", 42); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v and %v for the same seed, want the same order", got, want)
+	}
+	if got := shuffle("final-2024", 0); reflect.DeepEqual(got, tracks) {
+		t.Errorf("got %v, want the tracks shuffled", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// jsonFile keeps a value in memory and periodically writes it to disk as JSON, so it survives restarts.
+// It is embedded by the caches and indexes using it: they hold the lock while changing the value and mark it dirty,
+// so only changed values are written.
+type jsonFile struct {
+	file string
+	v    interface{}
+
+	sync.RWMutex
+	dirty bool
+}
+
+func newJSONFile(file string, v interface{}) jsonFile {
+	return jsonFile{file: file, v: v}
+}
+
+// Load reads the value from disk. A missing file is not an error.
+func (f *jsonFile) Load() error {
+	data, err := ioutil.ReadFile(f.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	return json.Unmarshal(data, f.v)
+}
+
+// Save writes the value to disk if it changed since the last save.
+func (f *jsonFile) Save() error {
+	f.Lock()
+	if !f.dirty {
+		f.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(f.v)
+	if err != nil {
+		f.Unlock()
+		return err
+	}
+	f.dirty = false
+	f.Unlock()
+
+	// changes made while writing mark the value dirty again by themselves,
+	// but a failed write has to be retried on the next save
+	err = writeFileAtomic(f.file, data)
+	if err != nil {
+		f.Lock()
+		f.dirty = true
+		f.Unlock()
+	}
+
+	return err
+}
+
+// Run saves the value every interval, forever.
+func (f *jsonFile) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := f.Save(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// saveOnExit saves the given files once the process is asked to stop, and then exits.
+// Without it, everything changed since the last periodic save would be lost on a restart.
+func saveOnExit(files ...*jsonFile) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	for _, f := range files {
+		if err := f.Save(); err != nil {
+			log.Println(err)
+		}
+	}
+	os.Exit(0)
+}
+
+// writeFileAtomic writes data to a temporary file first and then moves it in place,
+// so a crash halfway never leaves us with a truncated file.
+func writeFileAtomic(file string, data []byte) error {
+	tmp := file + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONFileSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "playlists.json")
+
+	saved := map[string]string{"a": "b"}
+	f := newJSONFile(file, &saved)
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("saved a value that was never marked dirty")
+	}
+
+	f.dirty = true
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := map[string]string{}
+	f = newJSONFile(file, &loaded)
+	if err := f.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded["a"] != "b" {
+		t.Errorf("got %v after loading, want %v", loaded, saved)
+	}
+
+	f = newJSONFile(filepath.Join(dir, "missing.json"), &loaded)
+	if err := f.Load(); err != nil {
+		t.Errorf("got %v for a missing file, want no error", err)
+	}
+}
+
+func TestJSONFileStaysDirtyWhenSaveFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "t2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved := map[string]string{"a": "b"}
+	f := newJSONFile(filepath.Join(dir, "missing", "playlists.json"), &saved)
+	f.dirty = true
+	if err := f.Save(); err == nil {
+		t.Fatal("saved into a directory that does not exist")
+	}
+	if !f.dirty {
+		t.Error("value is no longer dirty after a failed save")
+	}
+
+	f.file = filepath.Join(dir, "playlists.json")
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if f.dirty {
+		t.Error("value is still dirty after saving")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPlaylistName is the playlist name template used when PLAYLIST_NAME is not set.
+// Supported placeholders are {owner}, {source} and {edition}.
+const defaultPlaylistName = "{owner}'s {source} lijstje ({edition})"
+
+// playlistName builds the name of the playlist for the given list from the configured template.
+func playlistName(list *List, now time.Time) string {
+	tmpl := os.Getenv("PLAYLIST_NAME")
+	if tmpl == "" {
+		tmpl = defaultPlaylistName
+	}
+
+	edition := list.Edition
+	if edition == "" {
+		edition = votingSeason(now)
+	}
+
+	r := strings.NewReplacer(
+		"{owner}", list.Name,
+		"{source}", list.Title,
+		"{edition}", edition,
+	)
+	return strings.TrimSpace(r.Replace(tmpl))
+}
+
+// votingSeason returns the edition that is most likely meant at the given time.
+// Voting and the broadcast itself both happen at the end of the year,
+// so in January we are still talking about last year's edition.
+func votingSeason(now time.Time) string {
+	year := now.Year()
+	if now.Month() == time.January {
+		year--
+	}
+
+	return strconv.Itoa(year)
+}
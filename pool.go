@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// searchWorkers is the number of searches a single list runs concurrently.
+	searchWorkers = 8
+
+	// searchRate and searchBurst limit the number of searches per second, shared by all lists.
+	searchRate  = 10
+	searchBurst = 20
+)
+
+// searchLimiter is shared by every search we do, so a few big lists can not get us throttled by Spotify.
+var searchLimiter = newLimiter(searchRate, searchBurst)
+
+// limiter is a token bucket: it allows burst events at once and refills at rate tokens per second.
+// It can be paused, when the API we are limiting for asks us to back off.
+type limiter struct {
+	tokens chan struct{}
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newLimiter(rate int, burst int) *limiter {
+	l := &limiter{
+		tokens: make(chan struct{}, burst),
+	}
+	for i := 0; i < burst; i++ {
+		l.tokens <- struct{}{}
+	}
+
+	go func() {
+		for range time.Tick(time.Second / time.Duration(rate)) {
+			select {
+			case l.tokens <- struct{}{}:
+			default:
+				// bucket is full
+			}
+		}
+	}()
+
+	return l
+}
+
+// Wait blocks until the limiter is no longer paused and a token is available, or until ctx is done.
+func (l *limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	paused := time.Until(l.until)
+	l.mu.Unlock()
+
+	if paused > 0 {
+		select {
+		case <-time.After(paused):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case <-l.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause makes Wait block for at least d, for everyone waiting now or later.
+func (l *limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
+
+// parallel calls fn for every index in [0, n) using at most workers goroutines and waits for all of them.
+// Once ctx is done, remaining indices are skipped.
+func parallel(ctx context.Context, n int, workers int, fn func(i int)) {
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		indices <- i
+	}
+	close(indices)
+
+	wg.Wait()
+}
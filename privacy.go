@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lijstjesFile   = "lijstjes.dat"
+	lijstjesLayout = "2006-01-02 15:04:05"
+)
+
+// lijstjesMu guards lijstjes.dat, so entries can be removed without losing lines being appended.
+var lijstjesMu sync.Mutex
+
+// lijstje is a single logged lijstje URL.
+type lijstje struct {
+	Time time.Time `json:"time"`
+	URL  string    `json:"url"`
+}
+
+// sessionUser returns the Spotify user ID of whoever is logged in, or an empty string if nobody is.
+// All server-side data is tied to it, so users can export or remove it from any later session.
+func sessionUser(r *http.Request) string {
+	sess, _ := store.Get(r, sessionName)
+	uid, _ := sess.Values["spotifyUser"].(string)
+	return uid
+}
+
+// logLijstje writes a lijstje URL to file so we can do stuff later.
+// Lines are of the form "date time user url", so they can be exported or removed on request of the user.
+// Lijstjes of users that are not logged in are not logged at all, as nobody could ever remove them.
+func logLijstje(r *http.Request, url string) {
+	uid := sessionUser(r)
+	if uid == "" {
+		return
+	}
+
+	lijstjesMu.Lock()
+	defer lijstjesMu.Unlock()
+
+	f, err := os.OpenFile(lijstjesFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer f.Close()
+
+	// the URL is whatever the user pasted, so it must not be able to start a line of its own
+	url = strings.NewReplacer("\r", " ", "\n", " ").Replace(strings.TrimSpace(url))
+	f.WriteString(time.Now().Format(lijstjesLayout) + " " + uid + " " + url + "\n")
+}
+
+// parseLijstje parses a line of lijstjes.dat into the user key and the lijstje.
+// Lines logged before users were tracked have no user key and belong to nobody, as do lines logged for "-",
+// which is what lijstjes submitted without being logged in were logged under.
+// The URL is the rest of the line, as pasted URLs may contain spaces.
+func parseLijstje(line string) (string, lijstje, bool) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 4)
+	if len(fields) != 4 || fields[2] == "" || fields[3] == "" {
+		return "", lijstje{}, false
+	}
+
+	t, err := time.ParseInLocation(lijstjesLayout, fields[0]+" "+fields[1], time.Local)
+	if err != nil {
+		return "", lijstje{}, false
+	}
+
+	return fields[2], lijstje{Time: t, URL: fields[3]}, true
+}
+
+// userLijstjes returns all lijstjes logged for the given user.
+func userLijstjes(uid string) ([]lijstje, error) {
+	lijstjesMu.Lock()
+	defer lijstjesMu.Unlock()
+
+	l := make([]lijstje, 0)
+	f, err := os.Open(lijstjesFile)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if owner, e, ok := parseLijstje(scanner.Text()); ok && owner == uid {
+			l = append(l, e)
+		}
+	}
+
+	return l, scanner.Err()
+}
+
+// removeLijstjes removes all lijstjes logged for the given user and returns how many there were.
+func removeLijstjes(uid string) (int, error) {
+	lijstjesMu.Lock()
+	defer lijstjesMu.Unlock()
+
+	data, err := ioutil.ReadFile(lijstjesFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if owner, _, ok := parseLijstje(line); ok && owner == uid {
+			removed++
+			continue
+		}
+
+		kept.WriteString(line)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, writeFileAtomic(lijstjesFile, kept.Bytes())
+}
+
+// forgetUser deletes everything we keep for the user of this session: the session itself, including the OAuth token,
+// their jobs and their logged lijstjes. It returns the number of lijstjes and jobs removed.
+func forgetUser(w http.ResponseWriter, r *http.Request) (int, int, error) {
+	removed, forgotten := 0, 0
+	if uid := sessionUser(r); uid != "" {
+		var err error
+		removed, err = removeLijstjes(uid)
+		if err != nil {
+			return 0, 0, err
+		}
+		forgotten = jobs.Forget(uid)
+	}
+
+	return removed, forgotten, endSession(w, r)
+}
+
+// endSession deletes the session, including the OAuth token, but leaves all other data of the user alone.
+func endSession(w http.ResponseWriter, r *http.Request) error {
+	sess, _ := store.Get(r, sessionName)
+	for k := range sess.Values {
+		delete(sess.Values, k)
+	}
+	sess.Options.MaxAge = -1
+	return sess.Save(r, w)
+}
+
+// handleExport returns all data we keep for the current user as a JSON download.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	uid := sessionUser(r)
+	if uid == "" {
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	l, err := userLijstjes(uid)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errInternal,
+		})
+		return
+	}
+
+	type exportedJob struct {
+		ID       string    `json:"id"`
+		Created  time.Time `json:"created"`
+		Playlist string    `json:"playlist,omitempty"`
+	}
+	owned := make([]exportedJob, 0)
+	for _, j := range jobs.Owned(uid) {
+		e := exportedJob{ID: j.ID, Created: j.created}
+		events, _, _ := j.Events(0)
+		for _, ev := range events {
+			if ev.Type == "done" {
+				e.Playlist = ev.Playlist.String()
+			}
+		}
+		owned = append(owned, e)
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="top2000spotify.json"`)
+	je.Encode(map[string]interface{}{
+		"lijstjes":  l,
+		"jobs":      owned,
+		"playlists": synced.Owned(uid),
+		"reviewed":  matches.Reviewed(uid),
+	})
+}
+
+// handleForget deletes all data we keep for the current user and logs them out.
+// Unlike logging out, it also forgets which playlists we made for them, so lists are no longer synced to those,
+// and the tracks they picked while reviewing.
+func handleForget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		je.Encode(map[string]interface{}{
+			"error": errInternal,
+		})
+		return
+	}
+
+	synced.Forget(sessionUser(r))
+	matches.Forget(sessionUser(r))
+
+	lijstjes, forgotten, err := forgetUser(w, r)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errInternal,
+		})
+		return
+	}
+
+	je.Encode(map[string]int{
+		"lijstjes": lijstjes,
+		"jobs":     forgotten,
+	})
+}
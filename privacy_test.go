@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLijstje(t *testing.T) {
+	tests := []struct {
+		line string
+		uid  string
+		url  string
+		ok   bool
+	}{
+		{"2024-12-01 20:15:00 abc https://stem.nporadio2.nl/top-2000/share/abc123\n", "abc", "https://stem.nporadio2.nl/top-2000/share/abc123", true},
+		{"2024-12-01 20:15:00 abc stem.nporadio2.nl/top 2000/share/abc123", "abc", "stem.nporadio2.nl/top 2000/share/abc123", true},
+		{"2024-12-01 20:15:00 - https://stem.nporadio2.nl/top-2000/share/abc123", "-", "https://stem.nporadio2.nl/top-2000/share/abc123", true},
+		{"2017-12-01 20:15:00 https://stem.nporadio2.nl/top-2000/share/abc123", "", "", false},
+		{"gisteren abc https://stem.nporadio2.nl/top-2000/share/abc123 extra", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, test := range tests {
+		uid, l, ok := parseLijstje(test.line)
+		if uid != test.uid || l.URL != test.url || ok != test.ok {
+			t.Errorf("parseLijstje(%q) = %q, %q, %v, want %q, %q, %v", test.line, uid, l.URL, ok, test.uid, test.url, test.ok)
+		}
+	}
+
+	_, l, _ := parseLijstje("2024-12-01 20:15:00 abc https://stem.nporadio2.nl/top-2000/share/abc123")
+	if want := time.Date(2024, 12, 1, 20, 15, 0, 0, time.Local); !l.Time.Equal(want) {
+		t.Errorf("got time %s, want %s", l.Time, want)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/dannyvankooten/top2000spotify/matcher"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	// maxAlternatives is the number of alternative tracks returned for each entry in a preview.
+	maxAlternatives = 4
+	maxSearchQuery  = 200
+	errInvalidTrack = "Dat nummer of die playlist ken ik niet."
+)
+
+// trackIDRegexp matches Spotify's base-62 IDs, for tracks as well as playlists.
+var trackIDRegexp = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// reasonCached is added to the reasons of a track that was picked because the match cache knew it.
+const reasonCached matcher.Reason = "cached"
+
+// reviewTrack is a matched track as shown to the user for review.
+type reviewTrack struct {
+	ID         spotify.ID       `json:"id"`
+	Name       string           `json:"name"`
+	Artists    []string         `json:"artists"`
+	Album      string           `json:"album"`
+	Image      string           `json:"image"`
+	PreviewURL string           `json:"previewUrl"`
+	Score      float64          `json:"score"`
+	Reasons    []matcher.Reason `json:"reasons"`
+}
+
+// reviewItem is a single list entry along with the track we would pick for it and the alternatives.
+type reviewItem struct {
+	Entry        Entry         `json:"entry"`
+	Track        *reviewTrack  `json:"track"`
+	Alternatives []reviewTrack `json:"alternatives"`
+}
+
+func newReviewTrack(c matcher.Candidate) reviewTrack {
+	t := reviewTrack{
+		ID:         c.Track.ID,
+		Name:       c.Track.Name,
+		Artists:    make([]string, 0, len(c.Track.Artists)),
+		Album:      c.Track.Album.Name,
+		PreviewURL: c.Track.PreviewURL,
+		Score:      c.Score,
+		Reasons:    c.Reasons,
+	}
+	for _, a := range c.Track.Artists {
+		t.Artists = append(t.Artists, a.Name)
+	}
+	if len(c.Track.Album.Images) > 0 {
+		t.Image = c.Track.Album.Images[len(c.Track.Album.Images)-1].URL
+	}
+
+	return t
+}
+
+// handlePreview matches every entry of a list without writing anything to Spotify.
+// It returns the list along with the chosen track, its confidence and alternatives for every entry,
+// so the user can confirm, swap or drop tracks before committing the playlist.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		URL string `json:"url"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if err != nil || data.URL == "" {
+		je.Encode(map[string]interface{}{
+			"error": errInvalidList,
+		})
+		return
+	}
+
+	list, err := fetchList(data.URL)
+	if err != nil {
+		writeListError(je, err)
+		return
+	}
+
+	logLijstje(r, data.URL)
+
+	client, err := getAuthenticatedClient(w, r)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	m := newMatcher(client)
+	userID := sessionUser(r)
+	items := make([]reviewItem, len(list.Entries))
+
+	// entries we could not search for because of rate limiting are not unmatched, so the whole preview fails
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	parallel(ctx, len(list.Entries), searchWorkers, func(i int) {
+		e := list.Entries[i]
+		item := reviewItem{
+			Entry:        e,
+			Alternatives: make([]reviewTrack, 0),
+		}
+
+		candidates, err := previewCandidates(ctx, client, m, userID, e)
+		if err != nil {
+			cancel()
+			return
+		}
+
+		for j, c := range candidates {
+			if j > maxAlternatives {
+				break
+			}
+
+			t := newReviewTrack(c)
+			if j == 0 {
+				item.Track = &t
+			} else {
+				item.Alternatives = append(item.Alternatives, t)
+			}
+		}
+
+		items[i] = item
+	})
+
+	if ctx.Err() != nil {
+		log.Println(ctx.Err())
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyBusy,
+		})
+		return
+	}
+
+	je.Encode(map[string]interface{}{
+		"list": map[string]string{
+			"id":      list.ID,
+			"name":    list.Name,
+			"title":   list.Title,
+			"edition": list.Edition,
+		},
+		"items": items,
+	})
+}
+
+// previewCandidates matches e and puts the track from the match cache first, so the preview shows the track a
+// playlist created without review would get. Without a cached track, the best candidate is cached instead.
+// Like matchTrack, it only returns an error when Spotify rate limited us.
+func previewCandidates(ctx context.Context, client spotify.Client, m matcher.Matcher, userID string, e Entry) ([]matcher.Candidate, error) {
+	candidates, err := m.Match(ctx, matcher.Query{Artist: e.Artist, Title: e.Title})
+	if isRateLimited(err) {
+		return nil, err
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	id, ok := matches.Get(userID, e)
+	if !ok {
+		if len(candidates) > 0 {
+			matches.Set(e, candidates[0].Track.ID)
+		}
+		return candidates, nil
+	}
+
+	cached := matcher.Candidate{Score: 1}
+	found := false
+	for i, c := range candidates {
+		if c.Track.ID == id {
+			cached = c
+			candidates = append(candidates[:i:i], candidates[i+1:]...)
+			found = true
+			break
+		}
+	}
+
+	// the cached track may have been picked by the user, so it need not be among the candidates
+	if !found {
+		t, err := client.GetTrack(id)
+		if err != nil {
+			log.Println(err)
+			return candidates, nil
+		}
+		cached.Track = *t
+	}
+
+	cached.Reasons = append(append([]matcher.Reason{}, cached.Reasons...), reasonCached)
+	return append([]matcher.Candidate{cached}, candidates...), nil
+}
+
+// handleCommitPlaylist creates a playlist from a reviewed preview.
+// Every item holds the entry and the track the user picked for it; items without a (valid) track are dropped.
+func handleCommitPlaylist(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		List struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Title   string `json:"title"`
+			Edition string `json:"edition"`
+		} `json:"list"`
+		Items []struct {
+			Entry Entry      `json:"entry"`
+			Track spotify.ID `json:"track"`
+		} `json:"items"`
+		playlistOptions
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if err != nil || len(data.Items) == 0 {
+		je.Encode(map[string]interface{}{
+			"error": errInvalidList,
+		})
+		return
+	}
+	if !checkPlaylistOptions(je, r, &data.playlistOptions) {
+		return
+	}
+
+	list := &List{
+		ID:      data.List.ID,
+		Name:    data.List.Name,
+		Title:   data.List.Title,
+		Edition: data.List.Edition,
+	}
+	tracks := make([]spotify.ID, 0, len(data.Items))
+	for _, item := range data.Items {
+		if !trackIDRegexp.MatchString(string(item.Track)) {
+			continue
+		}
+
+		list.Entries = append(list.Entries, item.Entry)
+		tracks = append(tracks, item.Track)
+	}
+
+	client, err := getAuthenticatedClient(w, r)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	id, err := createPlaylist(client, list, tracks, data.playlistOptions)
+	if err != nil {
+		je.Encode(map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// the user confirmed or swapped these tracks, so their later playlists without review should get them too
+	if userID := sessionUser(r); userID != "" {
+		for i, e := range list.Entries {
+			matches.SetReviewed(userID, e, tracks[i])
+		}
+	}
+
+	je.Encode(map[string]string{
+		"playlist": id.String(),
+	})
+}
+
+// handleSearch lets an authenticated user search Spotify for a track, to replace an entry we could not match.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	client, err := getAuthenticatedClient(w, r)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || len(q) > maxSearchQuery {
+		je.Encode(map[string]interface{}{
+			"tracks": []reviewTrack{},
+		})
+		return
+	}
+
+	found, err := newSpotifySearcher(client).SearchTracks(r.Context(), q)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	tracks := make([]reviewTrack, 0, len(found))
+	for _, t := range found {
+		tracks = append(tracks, newReviewTrack(matcher.Candidate{Track: t}))
+	}
+
+	je.Encode(map[string]interface{}{
+		"tracks": tracks,
+	})
+}
+
+// handleAddTrack adds a single track to one of the current user's playlists.
+func handleAddTrack(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Playlist spotify.ID `json:"playlist"`
+		Track    spotify.ID `json:"track"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	w.Header().Set("Content-Type", "application/json")
+	je := json.NewEncoder(w)
+
+	if err != nil || !trackIDRegexp.MatchString(string(data.Playlist)) || !trackIDRegexp.MatchString(string(data.Track)) {
+		je.Encode(map[string]interface{}{
+			"error": errInvalidTrack,
+		})
+		return
+	}
+
+	client, err := getAuthenticatedClient(w, r)
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+	user, err := client.CurrentUser()
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	_, err = addTracksToPlaylist(&client, user.ID, data.Playlist, []spotify.ID{data.Track})
+	if err != nil {
+		log.Println(err)
+		je.Encode(map[string]interface{}{
+			"error": errSpotifyConn,
+		})
+		return
+	}
+
+	je.Encode(map[string]string{
+		"playlist": data.Playlist.String(),
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/sessions"
+	"github.com/zmb3/spotify"
+)
+
+const errMissingScope = "Daarvoor heb ik wat meer toestemming van je Spotify account nodig."
+
+// baseScopes are asked for at every login, they are needed for creating a playlist.
+var baseScopes = []string{spotify.ScopeUserReadPrivate, spotify.ScopePlaylistModifyPublic}
+
+// featureScopes holds the scopes every optional feature needs on top of baseScopes.
+// They are only asked for once the user wants to use the feature.
+// Private playlists need playlist-read-private as well, to check whether the user deleted them before updating them.
+var featureScopes = map[string][]string{
+	"private":       {spotify.ScopePlaylistModifyPrivate, spotify.ScopePlaylistReadPrivate},
+	"collaborative": {spotify.ScopePlaylistModifyPrivate, spotify.ScopePlaylistReadPrivate},
+	"library":       {spotify.ScopeUserLibraryModify},
+	"playback":      {spotify.ScopeUserModifyPlaybackState},
+	"cover":         {spotify.ScopeImageUpload},
+}
+
+// authenticators caches an authenticator for every set of scopes, as the scopes of a spotify.Authenticator are fixed.
+var authenticators = struct {
+	sync.Mutex
+	m map[string]spotify.Authenticator
+}{
+	m: make(map[string]spotify.Authenticator),
+}
+
+// authenticatorFor returns an authenticator asking for the given scopes.
+func authenticatorFor(scopes []string) spotify.Authenticator {
+	key := strings.Join(scopes, " ")
+
+	authenticators.Lock()
+	defer authenticators.Unlock()
+
+	a, ok := authenticators.m[key]
+	if !ok {
+		a = spotify.NewAuthenticator(redirectURI, scopes...)
+		a.SetAuthInfo(os.Getenv("SPOTIFY_ID"), os.Getenv("SPOTIFY_SECRET"))
+		authenticators.m[key] = a
+	}
+
+	return a
+}
+
+// grantedScopes returns the scopes the user granted at their last login.
+// Sessions from before scopes were tracked got baseScopes.
+func grantedScopes(sess *sessions.Session) []string {
+	if v, ok := sess.Values["scopes"].(string); ok {
+		return strings.Fields(v)
+	}
+	if _, ok := sessionToken(sess); ok {
+		return baseScopes
+	}
+
+	return nil
+}
+
+// loginScopes returns the scopes to ask for when the user logs in for the given features:
+// everything granted before plus whatever the features need, as a new token only covers the scopes asked for.
+// Unknown features are ignored.
+func loginScopes(sess *sessions.Session, features []string) []string {
+	scopes := append([]string{}, baseScopes...)
+	scopes = append(scopes, grantedScopes(sess)...)
+	for _, f := range features {
+		scopes = append(scopes, featureScopes[f]...)
+	}
+
+	return uniqueScopes(scopes)
+}
+
+// uniqueScopes sorts scopes and removes duplicates.
+func uniqueScopes(scopes []string) []string {
+	sort.Strings(scopes)
+
+	unique := make([]string, 0, len(scopes))
+	for i, s := range scopes {
+		if i == 0 || s != scopes[i-1] {
+			unique = append(unique, s)
+		}
+	}
+
+	return unique
+}
+
+// missingFeatures returns the features the user did not grant all scopes for.
+func missingFeatures(sess *sessions.Session, features ...string) []string {
+	granted := make(map[string]bool)
+	for _, s := range grantedScopes(sess) {
+		granted[s] = true
+	}
+
+	missing := make([]string, 0)
+	for _, f := range features {
+		for _, s := range featureScopes[f] {
+			if !granted[s] {
+				missing = append(missing, f)
+				break
+			}
+		}
+	}
+
+	return missing
+}
+
+// checkScopes reports whether the user granted the scopes for all given features.
+// If not, it writes an error along with the login URL asking for the missing scopes, so the client can send the user there
+// (with its own "return" and "url" parameters) and retry the action afterwards.
+func checkScopes(je *json.Encoder, r *http.Request, features ...string) bool {
+	sess, _ := store.Get(r, sessionName)
+	missing := missingFeatures(sess, features...)
+	if len(missing) == 0 {
+		return true
+	}
+
+	je.Encode(map[string]interface{}{
+		"error": errMissingScope,
+		"login": "/login?" + url.Values{"scope": {strings.Join(missing, ",")}}.Encode(),
+	})
+	return false
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dannyvankooten/top2000spotify/matcher"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+const (
+	errSpotifyBusy = "Spotify vindt dat ik te veel vraag. Probeer het over een paar minuten nog eens."
+
+	searchURL      = "https://api.spotify.com/v1/search"
+	searchTimeout  = 10 * time.Second
+	searchAttempts = 3
+	searchBackoff  = 500 * time.Millisecond
+
+	// defaultRetryAfter is how long we wait when Spotify rate limits us without saying for how long.
+	// A search is given up instead of retried when Spotify asks us to wait longer than maxRetryAfter.
+	defaultRetryAfter = 5 * time.Second
+	maxRetryAfter     = 30 * time.Second
+)
+
+var (
+	titleNormalizer  = matcher.DefaultTitleNormalizer
+	artistNormalizer = matcher.DefaultArtistNormalizer
+)
+
+// loadNormalizers reads the normalization rules from MATCH_TITLE_RULES and MATCH_ARTIST_RULES, if set.
+func loadNormalizers() error {
+	var err error
+	if rules := os.Getenv("MATCH_TITLE_RULES"); rules != "" {
+		titleNormalizer, err = matcher.NewNormalizer(rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	if rules := os.Getenv("MATCH_ARTIST_RULES"); rules != "" {
+		artistNormalizer, err = matcher.NewNormalizer(rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newMatcher returns the matcher used for all lists, searching with the given client.
+func newMatcher(client spotify.Client) *matcher.SearchMatcher {
+	m := matcher.New(newSpotifySearcher(client))
+	m.TitleNormalizer = titleNormalizer
+	m.ArtistNormalizer = artistNormalizer
+	return m
+}
+
+// spotifySearcher implements matcher.Searcher using the token of an authenticated Spotify client.
+// It does its own requests instead of using client.Search, because the client drops the Retry-After header of
+// rate limited responses.
+type spotifySearcher struct {
+	http    *http.Client
+	url     string
+	limiter *limiter
+}
+
+func newSpotifySearcher(client spotify.Client) spotifySearcher {
+	return spotifySearcher{
+		http: &http.Client{
+			Timeout: searchTimeout,
+			Transport: &oauth2.Transport{
+				Source: clientTokens{client},
+				Base:   retryAfterTransport{http.DefaultTransport},
+			},
+		},
+		url:     searchURL,
+		limiter: searchLimiter,
+	}
+}
+
+// SearchTracks waits for the search limiter and retries transient Spotify errors with exponential backoff.
+// When Spotify rate limits us, the limiter is paused for as long as Spotify asks, so all other searches wait as well.
+func (s spotifySearcher) SearchTracks(ctx context.Context, q string) ([]spotify.FullTrack, error) {
+	backoff := searchBackoff
+
+	for attempt := 1; ; attempt++ {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		tracks, err := s.search(ctx, q)
+		if err == nil {
+			return tracks, nil
+		}
+
+		wait := backoff
+		var limited rateLimitError
+		if errors.As(err, &limited) {
+			s.limiter.Pause(limited.RetryAfter)
+			wait = limited.RetryAfter
+		} else if !isTransient(err) {
+			return nil, err
+		} else {
+			backoff *= 2
+		}
+
+		if attempt >= searchAttempts || wait > maxRetryAfter {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// search does a single track search.
+func (s spotifySearcher) search(ctx context.Context, q string) ([]spotify.FullTrack, error) {
+	req, err := http.NewRequest("GET", s.url+"?"+url.Values{"q": {q}, "type": {"track"}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var data struct {
+			Error spotify.Error `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&data); err != nil || data.Error.Message == "" {
+			return nil, fmt.Errorf("spotify: HTTP %d: %s", res.StatusCode, http.StatusText(res.StatusCode))
+		}
+		data.Error.Status = res.StatusCode
+		return nil, data.Error
+	}
+
+	var result spotify.SearchResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Tracks == nil {
+		return nil, nil
+	}
+
+	return result.Tracks.Tracks, nil
+}
+
+// clientTokens hands out the token of a Spotify client, which refreshes it when it expires.
+type clientTokens struct {
+	client spotify.Client
+}
+
+func (t clientTokens) Token() (*oauth2.Token, error) {
+	return t.client.Token()
+}
+
+// rateLimitError is returned for requests Spotify rejected because we did too many.
+type rateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e rateLimitError) Error() string {
+	return fmt.Sprintf("spotify: rate limited, retry after %s", e.RetryAfter)
+}
+
+// retryAfterTransport turns rate limited responses into a rateLimitError holding the Retry-After header.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusTooManyRequests {
+		return res, err
+	}
+	res.Body.Close()
+
+	// Spotify sends the number of seconds to wait
+	retryAfter := defaultRetryAfter
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return nil, rateLimitError{retryAfter}
+}
+
+// isTransient returns whether err is worth retrying: server errors and network timeouts.
+func isTransient(err error) bool {
+	if e, ok := err.(spotify.Error); ok {
+		return e.Status >= 500
+	}
+
+	if e, ok := err.(net.Error); ok {
+		return e.Timeout()
+	}
+
+	// the client reports server errors without a body as plain errors
+	return strings.HasPrefix(err.Error(), "spotify: HTTP 5") || strings.HasPrefix(err.Error(), "spotify: couldn't decode error")
+}
+
+// matchEntries matches all entries concurrently and returns the matched track IDs in the same order.
+// Entries that could not be matched get an empty ID.
+// If progress is not nil, it is called after every entry with the number of entries done so far.
+// When Spotify keeps rate limiting us, the remaining entries are skipped and a rateLimitError is returned,
+// as those entries are not unmatched, we just do not know yet.
+func matchEntries(ctx context.Context, m matcher.Matcher, userID string, entries []Entry, progress func(done int, i int, e Entry, ID spotify.ID)) ([]spotify.ID, error) {
+	ids := make([]spotify.ID, len(entries))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var limited error
+	done := 0
+	parallel(ctx, len(entries), searchWorkers, func(i int) {
+		ID, err := matchTrack(ctx, m, userID, entries[i])
+		if isRateLimited(err) {
+			mu.Lock()
+			limited = err
+			mu.Unlock()
+			cancel()
+			return
+		}
+		ids[i] = ID
+
+		if progress != nil {
+			mu.Lock()
+			done++
+			progress(done, i, entries[i], ID)
+			mu.Unlock()
+		}
+	})
+
+	return ids, limited
+}
+
+// matchTrack returns the ID of the best matching Spotify track for e, or an empty ID if nothing matched.
+// The match cache is consulted first, including the tracks the user picked while reviewing, and updated with every new match.
+// Failed searches are logged and count as unmatched, unless Spotify rate limited us; that error is returned.
+func matchTrack(ctx context.Context, m matcher.Matcher, userID string, e Entry) (spotify.ID, error) {
+	if ID, ok := matches.Get(userID, e); ok {
+		return ID, nil
+	}
+
+	candidates, err := m.Match(ctx, matcher.Query{Artist: e.Artist, Title: e.Title})
+	if isRateLimited(err) {
+		return "", err
+	}
+	if err != nil {
+		log.Println(err)
+		return "", nil
+	}
+
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	ID := candidates[0].Track.ID
+	matches.Set(e, ID)
+	return ID, nil
+}
+
+// isRateLimited reports whether err means Spotify rate limited us for longer than we were willing to wait.
+func isRateLimited(err error) bool {
+	var limited rateLimitError
+	return errors.As(err, &limited)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dannyvankooten/top2000spotify/matcher"
+	"github.com/zmb3/spotify"
+)
+
+func TestSearchTracksHonorsRetryAfter(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		if q := r.URL.Query().Get("q"); q != "Queen Bohemian Rhapsody" {
+			t.Errorf("got query %q", q)
+		}
+		w.Write([]byte(`{"tracks": {"items": [{"id": "abc", "name": "Bohemian Rhapsody"}]}}`))
+	}))
+	defer server.Close()
+
+	s := spotifySearcher{
+		http:    &http.Client{Transport: retryAfterTransport{http.DefaultTransport}},
+		url:     server.URL,
+		limiter: newLimiter(searchRate, searchBurst),
+	}
+
+	start := time.Now()
+	tracks, err := s.SearchTracks(context.Background(), "Queen Bohemian Rhapsody")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracks) != 1 || tracks[0].ID != "abc" {
+		t.Errorf("got %+v, want the track from the second response", tracks)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the second Spotify asked for", elapsed)
+	}
+}
+
+func TestSearchTracksGivesUp(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		requests   int
+	}{
+		{"client error", http.StatusBadRequest, "", 1},
+		{"retry after too long", http.StatusTooManyRequests, "3600", 1},
+		{"server error", http.StatusBadGateway, "", searchAttempts},
+	}
+
+	for _, test := range tests {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if test.retryAfter != "" {
+				w.Header().Set("Retry-After", test.retryAfter)
+			}
+			w.WriteHeader(test.status)
+			w.Write([]byte(`{"error": {"status": 0, "message": "nope"}}`))
+		}))
+
+		s := spotifySearcher{
+			http:    &http.Client{Transport: retryAfterTransport{http.DefaultTransport}},
+			url:     server.URL,
+			limiter: newLimiter(searchRate, searchBurst),
+		}
+		_, err := s.SearchTracks(context.Background(), "Queen")
+		server.Close()
+
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if requests != test.requests {
+			t.Errorf("%s: got %d requests, want %d", test.name, requests, test.requests)
+		}
+	}
+}
+
+func TestLimiterPause(t *testing.T) {
+	l := newLimiter(1000, 1)
+	l.Pause(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait returned while the limiter was paused")
+	}
+}
+
+// throttledMatcher matches every entry to a track named after its title, except for "unknown" and the throttled title.
+type throttledMatcher struct {
+	throttled string
+}
+
+func (m throttledMatcher) Match(ctx context.Context, q matcher.Query) ([]matcher.Candidate, error) {
+	if q.Title == m.throttled {
+		return nil, &url.Error{Op: "Get", URL: searchURL, Err: rateLimitError{time.Minute}}
+	}
+	if q.Title == "unknown" {
+		return []matcher.Candidate{}, nil
+	}
+
+	c := matcher.Candidate{}
+	c.Track.ID = spotify.ID(q.Title)
+	return []matcher.Candidate{c}, nil
+}
+
+func TestMatchEntriesReportsThrottling(t *testing.T) {
+	entries := []Entry{
+		{Artist: "Throttle Test", Title: "first"},
+		{Artist: "Throttle Test", Title: "unknown"},
+	}
+
+	ids, err := matchEntries(context.Background(), throttledMatcher{}, "", entries, nil)
+	if err != nil || ids[0] != "first" || ids[1] != "" {
+		t.Errorf("got %v, %v, want the first entry matched and the second unmatched", ids, err)
+	}
+
+	entries = append(entries, Entry{Artist: "Throttle Test", Title: "throttled"})
+	if _, err := matchEntries(context.Background(), throttledMatcher{"throttled"}, "", entries, nil); !isRateLimited(err) {
+		t.Errorf("got %v, want a rate limit error instead of an unmatched entry", err)
+	}
+}
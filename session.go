@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// newSessionStore creates the session store with the keys from SESSION_KEYS.
+//
+// SESSION_KEYS holds one or more space separated "authenticationKey:encryptionKey" pairs, hex encoded.
+// The first pair is used to encode new cookies, all pairs are tried when decoding,
+// so keys can be rotated by prepending a new pair and removing the oldest one later on.
+// Generate a pair with: echo $(openssl rand -hex 32):$(openssl rand -hex 32)
+//
+// SESSION_STORE selects where sessions are kept: "cookie" (the default) keeps everything in the cookie,
+// "file" keeps sessions on disk in SESSION_DIR (default "sessions") and only the session ID in the cookie.
+func newSessionStore() (sessions.Store, error) {
+	keys, err := parseSessionKeys(os.Getenv("SESSION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+
+	var options *sessions.Options
+	var s sessions.Store
+	switch os.Getenv("SESSION_STORE") {
+	case "", "cookie":
+		cs := sessions.NewCookieStore(keys...)
+		cs.MaxAge(86400 * 30)
+		options, s = cs.Options, cs
+	case "file":
+		dir := os.Getenv("SESSION_DIR")
+		if dir == "" {
+			dir = "sessions"
+		}
+
+		fs, err := newFileSessionStore(dir, keys...)
+		if err != nil {
+			return nil, err
+		}
+		fs.MaxAge(86400 * 30)
+		options, s = fs.Options, fs
+	default:
+		return nil, fmt.Errorf("SESSION_STORE: unknown session store %q", os.Getenv("SESSION_STORE"))
+	}
+
+	options.HttpOnly = true
+	options.Secure = os.Getenv("COOKIE_SECURE") != "false"
+	return s, nil
+}
+
+// parseSessionKeys parses the key pairs in SESSION_KEYS.
+func parseSessionKeys(v string) ([][]byte, error) {
+	pairs := strings.Fields(v)
+	if len(pairs) == 0 {
+		return nil, errors.New("SESSION_KEYS is not set, refusing to start with unprotected sessions")
+	}
+
+	keys := make([][]byte, 0, 2*len(pairs))
+	for i, pair := range pairs {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("SESSION_KEYS: pair %d is not of the form authenticationKey:encryptionKey", i+1)
+		}
+
+		authKey, err := hex.DecodeString(parts[0])
+		if err != nil || len(authKey) < 32 {
+			return nil, fmt.Errorf("SESSION_KEYS: authentication key %d should be at least 32 hex encoded bytes", i+1)
+		}
+
+		encKey, err := hex.DecodeString(parts[1])
+		if err != nil || (len(encKey) != 16 && len(encKey) != 24 && len(encKey) != 32) {
+			return nil, fmt.Errorf("SESSION_KEYS: encryption key %d should be 16, 24 or 32 hex encoded bytes", i+1)
+		}
+
+		keys = append(keys, authKey, encKey)
+	}
+
+	return keys, nil
+}
+
+// cookieWriter adds the SameSite attribute to all cookies set through it, which the sessions package does not support.
+type cookieWriter struct {
+	http.ResponseWriter
+	sameSite    string
+	wroteHeader bool
+}
+
+func (w *cookieWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		cookies := w.Header()["Set-Cookie"]
+		for i, c := range cookies {
+			if !strings.Contains(strings.ToLower(c), "samesite=") {
+				cookies[i] = c + "; SameSite=" + w.sameSite
+			}
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cookieWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps Server-Sent Events working through the wrapper.
+func (w *cookieWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// secureCookies makes every cookie set by h a SameSite cookie, Lax by default or whatever COOKIE_SAMESITE says.
+// Lax still sends the session cookie along when Spotify redirects back to /callback.
+func secureCookies(h http.Handler) http.Handler {
+	sameSite := os.Getenv("COOKIE_SAMESITE")
+	if sameSite == "" {
+		sameSite = "Lax"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&cookieWriter{ResponseWriter: w, sameSite: sameSite}, r)
+	})
+}
+
+// sessionToken returns the OAuth token stored in the session, including its refresh token and expiry.
+func sessionToken(sess *sessions.Session) (*oauth2.Token, bool) {
+	v, ok := sess.Values["token"].(string)
+	if !ok || v == "" {
+		return nil, false
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(v), &token); err != nil || token.AccessToken == "" {
+		return nil, false
+	}
+
+	return &token, true
+}
+
+// saveSessionToken stores the full OAuth token in the session and saves it.
+func saveSessionToken(w http.ResponseWriter, r *http.Request, sess *sessions.Session, token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	sess.Values["token"] = string(data)
+	delete(sess.Values, "accessToken")
+	return sess.Save(r, w)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// maxFileSessionSize is the largest encoded session we write to disk; cookies are limited to 4096 bytes.
+	maxFileSessionSize = 64 * 1024
+
+	sessionGCInterval = time.Hour
+)
+
+// sessionIDRegexp matches the base32 session IDs generated by sessions.FilesystemStore.
+var sessionIDRegexp = regexp.MustCompile(`^[A-Z2-7]+$`)
+
+// fileSessionStore keeps session values on disk, one file per session, so the cookie only holds an (encrypted) session ID.
+// Sessions survive restarts and can be invalidated from the server by deleting their file.
+type fileSessionStore struct {
+	*sessions.FilesystemStore
+	dir string
+}
+
+func newFileSessionStore(dir string, keys ...[]byte) (*fileSessionStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileSessionStore{
+		FilesystemStore: sessions.NewFilesystemStore(dir, keys...),
+		dir:             dir,
+	}
+	s.MaxLength(maxFileSessionSize)
+	return s, nil
+}
+
+// Save writes the session to disk, or deletes it if its MaxAge is below zero.
+// Unlike sessions.FilesystemStore it does not fail on deleting a session that was never saved.
+func (s *fileSessionStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge > 0 {
+		return s.FilesystemStore.Save(r, w, sess)
+	}
+
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+	return s.Delete(sess.ID)
+}
+
+// Delete removes the session with the given ID, if it exists.
+func (s *fileSessionStore) Delete(id string) error {
+	if !sessionIDRegexp.MatchString(id) {
+		return nil
+	}
+
+	err := os.Remove(s.filename(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileSessionStore) filename(id string) string {
+	return filepath.Join(s.dir, "session_"+id)
+}
+
+// Run removes expired sessions every interval.
+func (s *fileSessionStore) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.GC(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// GC removes all sessions that were not saved within MaxAge, their cookie has expired as well.
+func (s *fileSessionStore) GC() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	maxAge := time.Duration(s.Options.MaxAge) * time.Second
+	for _, f := range files {
+		id := strings.TrimPrefix(f.Name(), "session_")
+		if id == f.Name() || time.Since(f.ModTime()) < maxAge {
+			continue
+		}
+
+		if err := s.Delete(id); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import "strings"
+
+// Entry is a single track on a list, normalized across all list sources.
+type Entry struct {
+	Artist    string `json:"artist"`
+	Title     string `json:"title"`
+	Image     string `json:"image"`
+	CatalogID string `json:"catalogId"`
+}
+
+// List is what a ListSource returns: the name of whoever made the list, the title and edition of the poll or chart it belongs to and its entries, in order.
+type List struct {
+	// ID identifies the list at its source, so resubmitting it updates the playlist made before. Imported lists have none.
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Title   string  `json:"title"`
+	Edition string  `json:"edition"`
+	Entries []Entry `json:"entries"`
+}
+
+// ListSource knows how to recognize and fetch lists from a single provider.
+type ListSource interface {
+	// Detect returns the list ID for the given URL and whether this source recognized it.
+	Detect(url string) (string, bool)
+
+	// Fetch retrieves the list with the given ID.
+	Fetch(id string) (*List, error)
+}
+
+// sources holds all registered list sources, in order of precedence.
+var sources = []ListSource{
+	newNPOSource(),
+	newRankingSource(),
+}
+
+// fetchList resolves the given link, finds the first source recognizing it and fetches the list from it.
+func fetchList(link string) (*List, error) {
+	url, err := resolveLink(link)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sources {
+		id, ok := s.Detect(url)
+		if !ok {
+			continue
+		}
+
+		list, err := s.Fetch(id)
+		if err != nil {
+			return nil, err
+		}
+
+		list.ID = id
+		return list, nil
+	}
+
+	// a share link of some other site
+	if strings.Contains(url, "/share/") {
+		return nil, &linkError{Link: link, Part: "host", Hint: "Deze link komt niet van de NPO stemsite."}
+	}
+
+	return nil, &linkError{Link: link, Part: "path", Hint: "Ik herken deze link niet als een lijstje."}
+}
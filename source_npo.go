@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultNPOForm is the form slug used for share links that do not carry one.
+	defaultNPOForm = "top-2000"
+
+	npoTimeout = 10 * time.Second
+)
+
+// npoHosts are the hosts share links of the stem-backend forms live on, including the aliases the NPO shares them on.
+// The host does not matter for fetching, the share ID is all we need.
+var npoHosts = map[string]bool{
+	"stem.nporadio2.nl": true,
+	"stem.npo.nl":       true,
+	"nporadio2.nl":      true,
+	"www.nporadio2.nl":  true,
+	"m.nporadio2.nl":    true,
+	"npo.nl":            true,
+	"www.npo.nl":        true,
+}
+
+// npoForms maps known stem-backend form slugs to a readable title.
+// It is only used when the form metadata itself does not provide a title.
+var npoForms = map[string]string{
+	"top-2000":            "Top 2000",
+	"top-40-allertijden":  "Top 40 Allertijden",
+	"evergreen-top-1000":  "Evergreen Top 1000",
+	"top-100-allertijden": "Top 100 Allertijden",
+}
+
+// npoForm holds the metadata of a single stem-backend form.
+type npoForm struct {
+	Slug    string
+	Title   string
+	Edition string
+}
+
+// npoSource fetches personal shortlists from the NPO stem-backend, for any of its forms.
+type npoSource struct {
+	baseURL string
+	re      *regexp.Regexp
+	client  *http.Client
+
+	sync.Mutex
+	forms map[string]*npoForm
+}
+
+func newNPOSource() *npoSource {
+	return &npoSource{
+		baseURL: "https://stem-backend.npo.nl/api/form/",
+		re:      regexp.MustCompile(`(?:\/([\w-]+))?\/share\/(\w+)$`),
+		client:  &http.Client{Timeout: npoTimeout},
+		forms:   make(map[string]*npoForm),
+	}
+}
+
+// Detect returns an ID of the form "<form slug>/<share id>", for share links on one of the npoHosts.
+func (s *npoSource) Detect(rawurl string) (string, bool) {
+	u, err := url.Parse(rawurl)
+	if err != nil || !npoHosts[strings.ToLower(u.Hostname())] {
+		return "", false
+	}
+
+	matches := s.re.FindStringSubmatch(u.Path)
+	if matches == nil || len(matches) < 3 {
+		return "", false
+	}
+
+	slug := matches[1]
+	if slug == "" {
+		slug = defaultNPOForm
+	}
+
+	return slug + "/" + matches[2], true
+}
+
+func (s *npoSource) Fetch(id string) (*List, error) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("npo: invalid list id %q", id)
+	}
+	slug, shareID := parts[0], parts[1]
+
+	var data struct {
+		Name  string `json:"name"`
+		Items []struct {
+			ID     string `json:"_id"`
+			Source struct {
+				Artist       string `json:"artist"`
+				Title        string `json:"title"`
+				SpotifyImage string `json:"spotifyImage"`
+			} `json:"_source"`
+		} `json:"shortlist"`
+	}
+	err := s.get(slug+"/"+shareID, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	form := s.form(slug)
+	list := &List{
+		Name:    data.Name,
+		Title:   form.Title,
+		Edition: form.Edition,
+		Entries: make([]Entry, 0, len(data.Items)),
+	}
+	for _, item := range data.Items {
+		list.Entries = append(list.Entries, Entry{
+			Artist:    item.Source.Artist,
+			Title:     item.Source.Title,
+			Image:     item.Source.SpotifyImage,
+			CatalogID: item.ID,
+		})
+	}
+
+	return list, nil
+}
+
+// form returns the metadata for the given form slug.
+// Metadata is fetched once per slug; on failure it falls back to the npoForms table and is fetched again next time.
+func (s *npoSource) form(slug string) *npoForm {
+	s.Lock()
+	f, ok := s.forms[slug]
+	s.Unlock()
+	if ok {
+		return f
+	}
+
+	f = &npoForm{Slug: slug}
+
+	var data struct {
+		Title   string `json:"title"`
+		Name    string `json:"name"`
+		Edition string `json:"edition"`
+		Year    int    `json:"year"`
+	}
+	err := s.get(slug, &data)
+	if err == nil {
+		f.Title = data.Title
+		if f.Title == "" {
+			f.Title = data.Name
+		}
+
+		f.Edition = data.Edition
+		if f.Edition == "" && data.Year > 0 {
+			f.Edition = strconv.Itoa(data.Year)
+		}
+	}
+
+	if f.Title == "" {
+		f.Title = npoForms[slug]
+	}
+
+	if f.Title == "" {
+		f.Title = strings.Replace(slug, "-", " ", -1)
+	}
+
+	// only remember forms we actually got metadata for, so a failing request does not leave us without an edition
+	if err == nil {
+		s.Lock()
+		s.forms[slug] = f
+		s.Unlock()
+	}
+
+	return f
+}
+
+// get fetches the given stem-backend path and decodes the JSON response into v.
+func (s *npoSource) get(path string, v interface{}) error {
+	resp, err := s.client.Get(s.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("npo: unexpected status %d for %s", resp.StatusCode, path)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
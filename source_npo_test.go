@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNPODetect(t *testing.T) {
+	tests := []struct {
+		url string
+		id  string
+		ok  bool
+	}{
+		{"https://stem.nporadio2.nl/top-2000/share/abc123", "top-2000/abc123", true},
+		{"https://stem.nporadio2.nl/top-40-allertijden/share/abc123", "top-40-allertijden/abc123", true},
+		{"https://stem.nporadio2.nl/share/abc123", "top-2000/abc123", true},
+		{"https://stem.nporadio2.nl/top-2000/share/", "", false},
+		{"https://stem.nporadio2.nl/top-2000", "", false},
+		{"https://www.nporadio2.nl/top2000", "", false},
+		{"https://m.nporadio2.nl/top-2000/share/abc123", "top-2000/abc123", true},
+		{"https://www.nporadio2.nl/top-2000/share/abc123", "top-2000/abc123", true},
+		{"https://www.npo.nl/top-2000/share/abc123", "top-2000/abc123", true},
+		{"https://example.com/foo/share/abc123", "", false},
+		{"https://stem.nporadio2.nl.example.com/top-2000/share/abc123", "", false},
+	}
+
+	s := newNPOSource()
+	for _, test := range tests {
+		id, ok := s.Detect(test.url)
+		if id != test.id || ok != test.ok {
+			t.Errorf("Detect(%q) = %q, %v, want %q, %v", test.url, id, ok, test.id, test.ok)
+		}
+	}
+}
+
+func TestNPOFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/top-2000":
+			w.Write([]byte(`{"title": "Top 2000", "year": 2024}`))
+		case "/top-2000/abc123":
+			w.Write([]byte(`{
+				"name": "Danny",
+				"shortlist": [
+					{"_id": "1", "_source": {"artist": "Queen", "title": "Bohemian Rhapsody", "spotifyImage": "queen.jpg"}},
+					{"_id": "2", "_source": {"artist": "André Hazes", "title": "Zij Gelooft In Mij"}}
+				]
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := newNPOSource()
+	s.baseURL = server.URL + "/"
+
+	list, err := s.Fetch("top-2000/abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list.Name != "Danny" || list.Title != "Top 2000" || list.Edition != "2024" {
+		t.Errorf("got list %q, %q, %q, want Danny, Top 2000, 2024", list.Name, list.Title, list.Edition)
+	}
+
+	want := []Entry{
+		{Artist: "Queen", Title: "Bohemian Rhapsody", Image: "queen.jpg", CatalogID: "1"},
+		{Artist: "André Hazes", Title: "Zij Gelooft In Mij", CatalogID: "2"},
+	}
+	if len(list.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(list.Entries), len(want))
+	}
+	for i, e := range list.Entries {
+		if e != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+
+	if _, err := s.Fetch("top-2000/missing"); err == nil {
+		t.Error("expected an error for a missing shortlist")
+	}
+}
+
+func TestNPOFormRetriesFailedMetadata(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+
+		w.Write([]byte(`{"title": "Top 2000", "edition": "2024"}`))
+	}))
+	defer server.Close()
+
+	s := newNPOSource()
+	s.baseURL = server.URL + "/"
+
+	if f := s.form("top-2000"); f.Title != "Top 2000" || f.Edition != "" {
+		t.Errorf("got %q, %q while failing, want Top 2000 from the table without edition", f.Title, f.Edition)
+	}
+
+	fail = false
+	if f := s.form("top-2000"); f.Edition != "2024" {
+		t.Errorf("got edition %q after recovering, want 2024", f.Edition)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// rankingTimeout is how long we wait for the ranking page, it is big but should not take forever.
+const rankingTimeout = 20 * time.Second
+
+// rankingSource reads the official, final Top 2000 ranking.
+// It scrapes the published ranking page, unless a local CSV or JSON dataset is configured through RANKING_FILE.
+type rankingSource struct {
+	pageURL string
+	file    string
+	edition string
+	client  *http.Client
+
+	// CSS selectors used when scraping the ranking page
+	rowSelector      string
+	positionSelector string
+	artistSelector   string
+	titleSelector    string
+}
+
+// rankedEntry is an Entry with its position in the ranking.
+type rankedEntry struct {
+	Position int
+	Entry
+}
+
+func newRankingSource() *rankingSource {
+	pageURL := os.Getenv("RANKING_URL")
+	if pageURL == "" {
+		pageURL = "https://www.nporadio2.nl/top2000"
+	}
+
+	return &rankingSource{
+		pageURL:          pageURL,
+		file:             os.Getenv("RANKING_FILE"),
+		edition:          os.Getenv("RANKING_EDITION"),
+		client:           &http.Client{Timeout: rankingTimeout},
+		rowSelector:      "table tbody tr",
+		positionSelector: "td:nth-child(1)",
+		titleSelector:    "td:nth-child(2)",
+		artistSelector:   "td:nth-child(3)",
+	}
+}
+
+// Detect recognizes the ranking page URL, ignoring scheme, query string and trailing slashes.
+// The ID includes the edition, so every year's ranking gets a playlist of its own.
+func (s *rankingSource) Detect(rawurl string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		return "", false
+	}
+
+	page, err := url.Parse(s.pageURL)
+	if err != nil {
+		return "", false
+	}
+
+	host := strings.TrimPrefix(u.Host, "www.")
+	if host != strings.TrimPrefix(page.Host, "www.") || strings.TrimSuffix(u.Path, "/") != strings.TrimSuffix(page.Path, "/") {
+		return "", false
+	}
+
+	return "final-" + s.currentEdition(), true
+}
+
+// currentEdition returns the configured edition or, if there is none, the edition of the current voting season.
+func (s *rankingSource) currentEdition() string {
+	if s.edition != "" {
+		return s.edition
+	}
+
+	return votingSeason(time.Now())
+}
+
+func (s *rankingSource) Fetch(id string) (*List, error) {
+	var entries []rankedEntry
+	var err error
+
+	if s.file != "" {
+		entries, err = s.readFile(s.file)
+	} else {
+		entries, err = s.scrape()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("ranking: no entries found")
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Position < entries[j].Position
+	})
+
+	list := &List{
+		Name:    "NPO Radio 2",
+		Title:   "Top 2000",
+		Edition: s.currentEdition(),
+		Entries: make([]Entry, 0, len(entries)),
+	}
+	for _, e := range entries {
+		list.Entries = append(list.Entries, e.Entry)
+	}
+
+	return list, nil
+}
+
+// scrape reads the ranking from the published ranking page.
+func (s *rankingSource) scrape() ([]rankedEntry, error) {
+	resp, err := s.client.Get(s.pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ranking: unexpected status %d for %s", resp.StatusCode, s.pageURL)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]rankedEntry, 0, 2000)
+	doc.Find(s.rowSelector).Each(func(i int, row *goquery.Selection) {
+		e := rankedEntry{
+			Entry: Entry{
+				Artist: strings.TrimSpace(row.Find(s.artistSelector).Text()),
+				Title:  strings.TrimSpace(row.Find(s.titleSelector).Text()),
+			},
+		}
+		if e.Artist == "" || e.Title == "" {
+			return
+		}
+
+		e.Position = i + 1
+		if p, err := strconv.Atoi(strings.TrimSpace(row.Find(s.positionSelector).Text())); err == nil {
+			e.Position = p
+		}
+
+		entries = append(entries, e)
+	})
+
+	return entries, nil
+}
+
+// readFile reads the ranking from a local dataset, either CSV or JSON depending on the file extension.
+func (s *rankingSource) readFile(name string) ([]rankedEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(name)) == ".json" {
+		return readRankingJSON(f)
+	}
+
+	return readRankingCSV(f, ',')
+}
+
+// readRankingJSON reads an array of {"position", "artist", "title"} objects.
+func readRankingJSON(r io.Reader) ([]rankedEntry, error) {
+	var data []struct {
+		Position int    `json:"position"`
+		Artist   string `json:"artist"`
+		Title    string `json:"title"`
+		ID       string `json:"id"`
+	}
+	err := json.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]rankedEntry, 0, len(data))
+	for i, d := range data {
+		if d.Position == 0 {
+			d.Position = i + 1
+		}
+
+		entries = append(entries, rankedEntry{
+			Position: d.Position,
+			Entry: Entry{
+				Artist:    d.Artist,
+				Title:     d.Title,
+				CatalogID: d.ID,
+			},
+		})
+	}
+
+	return entries, nil
+}
+
+// readRankingCSV reads a CSV file, preferably with a header row.
+// Columns are found by name, in either Dutch or English (positie/position, artiest/artist, titel/title).
+// Files without such a header are read as "artist, title" rows.
+func readRankingCSV(r io.Reader, comma rune) ([]rankedEntry, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{"position": -1, "artist": -1, "title": -1}
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "positie", "position", "pos", "nr":
+			columns["position"] = i
+		case "artiest", "artist":
+			columns["artist"] = i
+		case "titel", "title":
+			columns["title"] = i
+		}
+	}
+
+	// without a recognizable header, assume the first row is data in "artist, title" order
+	var first []string
+	if columns["artist"] < 0 || columns["title"] < 0 {
+		if len(header) < 2 {
+			return nil, fmt.Errorf("ranking: csv is missing an artist or title column")
+		}
+
+		columns = map[string]int{"position": -1, "artist": 0, "title": 1}
+		first = header
+	}
+
+	entries := make([]rankedEntry, 0, 2000)
+	for {
+		record := first
+		first = nil
+		if record == nil {
+			record, err = cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		e := rankedEntry{
+			Position: len(entries) + 1,
+		}
+		if c := columns["position"]; c >= 0 && c < len(record) {
+			if p, err := strconv.Atoi(strings.TrimSpace(record[c])); err == nil {
+				e.Position = p
+			}
+		}
+		if c := columns["artist"]; c < len(record) {
+			e.Artist = strings.TrimSpace(record[c])
+		}
+		if c := columns["title"]; c < len(record) {
+			e.Title = strings.TrimSpace(record[c])
+		}
+		if e.Artist == "" || e.Title == "" {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRankingCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		csv   string
+		comma rune
+		want  []rankedEntry
+	}{
+		{
+			name:  "dutch header",
+			csv:   "positie,titel,artiest\n2,Hotel California,Eagles\n1,Bohemian Rhapsody,Queen\n",
+			comma: ',',
+			want: []rankedEntry{
+				{Position: 2, Entry: Entry{Artist: "Eagles", Title: "Hotel California"}},
+				{Position: 1, Entry: Entry{Artist: "Queen", Title: "Bohemian Rhapsody"}},
+			},
+		},
+		{
+			name:  "english header with semicolons",
+			csv:   "Artist;Title\nQueen;Bohemian Rhapsody\nAndré Hazes;Zij Gelooft In Mij\n",
+			comma: ';',
+			want: []rankedEntry{
+				{Position: 1, Entry: Entry{Artist: "Queen", Title: "Bohemian Rhapsody"}},
+				{Position: 2, Entry: Entry{Artist: "André Hazes", Title: "Zij Gelooft In Mij"}},
+			},
+		},
+		{
+			name:  "no header",
+			csv:   "Queen, Bohemian Rhapsody\nEagles, Hotel California\n",
+			comma: ',',
+			want: []rankedEntry{
+				{Position: 1, Entry: Entry{Artist: "Queen", Title: "Bohemian Rhapsody"}},
+				{Position: 2, Entry: Entry{Artist: "Eagles", Title: "Hotel California"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := readRankingCSV(strings.NewReader(test.csv), test.comma)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %d entries, want %d", test.name, len(got), len(test.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: entry %d = %+v, want %+v", test.name, i, got[i], test.want[i])
+			}
+		}
+	}
+
+	if _, err := readRankingCSV(strings.NewReader("just one column\n"), ','); err == nil {
+		t.Error("expected an error for a csv without artist and title")
+	}
+}
+
+func TestReadRankingJSON(t *testing.T) {
+	data := `[
+		{"position": 1, "artist": "Queen", "title": "Bohemian Rhapsody", "id": "q1"},
+		{"artist": "Eagles", "title": "Hotel California"}
+	]`
+
+	got, err := readRankingJSON(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rankedEntry{
+		{Position: 1, Entry: Entry{Artist: "Queen", Title: "Bohemian Rhapsody", CatalogID: "q1"}},
+		{Position: 2, Entry: Entry{Artist: "Eagles", Title: "Hotel California"}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if _, err := readRankingJSON(strings.NewReader(`{"not": "an array"}`)); err == nil {
+		t.Error("expected an error for JSON that is not an array")
+	}
+}
+
+func TestRankingDetect(t *testing.T) {
+	s := newRankingSource()
+	s.pageURL = "https://www.nporadio2.nl/top2000"
+
+	tests := []struct {
+		url     string
+		edition string
+		id      string
+		ok      bool
+	}{
+		{"https://www.nporadio2.nl/top2000", "", "final-" + votingSeason(time.Now()), true},
+		{"http://nporadio2.nl/top2000/?ref=home", "2024", "final-2024", true},
+		{"https://www.nporadio2.nl/top2000", "2025", "final-2025", true},
+		{"https://www.nporadio2.nl/top40", "2024", "", false},
+	}
+
+	for _, test := range tests {
+		s.edition = test.edition
+		id, ok := s.Detect(test.url)
+		if id != test.id || ok != test.ok {
+			t.Errorf("Detect(%q) for edition %q = %q, %v, want %q, %v", test.url, test.edition, id, ok, test.id, test.ok)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const syncedSaveInterval = 30 * time.Second
+
+// syncedPlaylist is a playlist we created for a list, as it was after we last changed it.
+type syncedPlaylist struct {
+	PlaylistID spotify.ID   `json:"playlist"`
+	SnapshotID string       `json:"snapshot"`
+	Visibility string       `json:"visibility"`
+	Edition    string       `json:"edition"`
+	Tracks     []spotify.ID `json:"tracks"`
+	SyncedAt   time.Time    `json:"syncedAt"`
+}
+
+// playlistIndex remembers which playlist belongs to which list and Spotify user, so resubmitting a list updates that playlist.
+// Like the match cache it lives in memory and is periodically written to disk, see jsonFile.
+type playlistIndex struct {
+	jsonFile
+	playlists map[string]syncedPlaylist
+}
+
+var synced = newPlaylistIndex()
+
+func newPlaylistIndex() *playlistIndex {
+	file := os.Getenv("PLAYLISTS_FILE")
+	if file == "" {
+		file = "playlists.json"
+	}
+
+	p := &playlistIndex{
+		playlists: make(map[string]syncedPlaylist),
+	}
+	p.jsonFile = newJSONFile(file, &p.playlists)
+	return p
+}
+
+// playlistEditor is the part of the Spotify client used to change the tracks of a playlist.
+type playlistEditor interface {
+	AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (string, error)
+	RemoveTracksFromPlaylistOpt(userID string, playlistID spotify.ID, tracks []spotify.TrackToRemove, snapshotID string) (string, error)
+	ReorderPlaylistTracks(userID string, playlistID spotify.ID, opt spotify.PlaylistReorderOptions) (string, error)
+	ReplacePlaylistTracks(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) error
+}
+
+func playlistKey(userID string, listID string) string {
+	return userID + " " + listID
+}
+
+// Get returns the playlist created for the given list and user, if any.
+func (p *playlistIndex) Get(userID string, listID string) (syncedPlaylist, bool) {
+	p.RLock()
+	defer p.RUnlock()
+
+	s, ok := p.playlists[playlistKey(userID, listID)]
+	return s, ok
+}
+
+// Set remembers the playlist created for the given list and user.
+func (p *playlistIndex) Set(userID string, listID string, s syncedPlaylist) {
+	p.Lock()
+	defer p.Unlock()
+
+	s.SyncedAt = time.Now()
+	p.playlists[playlistKey(userID, listID)] = s
+	p.dirty = true
+}
+
+// Owned returns all playlists of the given user, by list ID.
+func (p *playlistIndex) Owned(userID string) map[string]syncedPlaylist {
+	p.RLock()
+	defer p.RUnlock()
+
+	owned := make(map[string]syncedPlaylist)
+	prefix := playlistKey(userID, "")
+	for k, s := range p.playlists {
+		if userID != "" && len(k) > len(prefix) && k[:len(prefix)] == prefix {
+			owned[k[len(prefix):]] = s
+		}
+	}
+
+	return owned
+}
+
+// Forget removes all playlists of the given user from the index and returns how many there were.
+// The playlists themselves are left alone.
+func (p *playlistIndex) Forget(userID string) int {
+	owned := p.Owned(userID)
+
+	p.Lock()
+	defer p.Unlock()
+
+	for listID := range owned {
+		delete(p.playlists, playlistKey(userID, listID))
+	}
+	if len(owned) > 0 {
+		p.dirty = true
+	}
+
+	return len(owned)
+}
+
+// syncPlaylist updates the playlist made for this list before, if there is one of the same edition and the user
+// still follows it. It reports whether it did, so a new playlist can be created otherwise.
+//
+// Only tracks we added ourselves are removed, tracks the user or their family added stay at the end.
+// Every removal and move is done against the snapshot the previous change returned,
+// so Spotify rejects it instead of moving the wrong tracks when the playlist changes halfway.
+func syncPlaylist(client spotify.Client, userID string, list *List, tracks []spotify.ID, opts playlistOptions) (spotify.ID, bool, error) {
+	prev, ok := synced.Get(userID, list.ID)
+	if !ok || prev.Edition != list.Edition {
+		return "", false, nil
+	}
+
+	playlist, err := client.GetPlaylist(userID, prev.PlaylistID)
+	if err != nil {
+		log.Println(err)
+		return "", false, nil
+	}
+
+	// deleting a playlist in Spotify only unfollows it. Checking that for a private playlist needs playlist-read-private,
+	// which the private and collaborative features ask for. Without it Spotify says we do not follow it,
+	// so a new playlist is made rather than updating one that may have been deleted.
+	follows, err := client.UserFollowsPlaylist(userID, prev.PlaylistID, userID)
+	if err != nil {
+		log.Println(err)
+	}
+	following := err == nil && len(follows) == 1 && follows[0]
+	if !following && (err == nil || !playlist.IsPublic) {
+		return "", false, nil
+	}
+
+	current, err := playlistTrackIDs(client, userID, playlist)
+	if err != nil {
+		return "", true, err
+	}
+	if prev.SnapshotID != "" && playlist.SnapshotID != prev.SnapshotID {
+		log.Printf("playlist %s changed since our last sync, keeping tracks added by others\n", prev.PlaylistID)
+	}
+
+	if opts.Visibility != prev.Visibility {
+		err = changePlaylistAccess(client, prev.PlaylistID, opts)
+		if err != nil {
+			return "", true, err
+		}
+	}
+
+	snapshot := playlist.SnapshotID
+	current, snapshot, err = removeDroppedTracks(&client, userID, prev, current, tracks, snapshot)
+	if err != nil {
+		return "", true, err
+	}
+
+	missing := missingTracks(current, prev.Tracks, tracks)
+	if len(missing) > 0 {
+		snapshot, err = addTracksToPlaylist(&client, userID, prev.PlaylistID, missing)
+		if err != nil {
+			return "", true, err
+		}
+		current = append(current, missing...)
+	}
+
+	snapshot, err = reorderTracks(&client, userID, prev.PlaylistID, current, tracks, snapshot)
+	if err != nil {
+		return "", true, err
+	}
+
+	synced.Set(userID, list.ID, syncedPlaylist{
+		PlaylistID: prev.PlaylistID,
+		SnapshotID: snapshot,
+		Visibility: opts.Visibility,
+		Edition:    list.Edition,
+		Tracks:     tracks,
+	})
+	return prev.PlaylistID, true, nil
+}
+
+// playlistTrackIDs returns the IDs of all tracks on the playlist, in order.
+func playlistTrackIDs(client spotify.Client, userID string, playlist *spotify.FullPlaylist) ([]spotify.ID, error) {
+	ids := make([]spotify.ID, 0, playlist.Tracks.Total)
+	page := &playlist.Tracks
+	for {
+		for _, t := range page.Tracks {
+			ids = append(ids, t.Track.ID)
+		}
+		if len(page.Tracks) == 0 || len(ids) >= page.Total {
+			return ids, nil
+		}
+
+		offset, limit := len(ids), maxTracksPerRequest
+		var err error
+		page, err = client.GetPlaylistTracksOpt(userID, playlist.ID, &spotify.Options{Offset: &offset, Limit: &limit}, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeDroppedTracks removes the tracks we added before that are no longer on the list.
+// It returns the remaining tracks and the new snapshot ID.
+func removeDroppedTracks(client playlistEditor, userID string, prev syncedPlaylist, current []spotify.ID, tracks []spotify.ID, snapshot string) ([]spotify.ID, string, error) {
+	ours := countTracks(prev.Tracks)
+	wanted := countTracks(tracks)
+	dropped := make([]int, 0)
+	for i, id := range current {
+		if ours[id] == 0 {
+			continue
+		}
+		ours[id]--
+
+		if wanted[id] > 0 {
+			wanted[id]--
+		} else {
+			dropped = append(dropped, i)
+		}
+	}
+
+	// remove from the end, so positions in later batches are still valid
+	sort.Sort(sort.Reverse(sort.IntSlice(dropped)))
+	for start := 0; start < len(dropped); start += maxTracksPerRequest {
+		end := start + maxTracksPerRequest
+		if end > len(dropped) {
+			end = len(dropped)
+		}
+
+		remove := make([]spotify.TrackToRemove, 0, end-start)
+		for _, i := range dropped[start:end] {
+			remove = append(remove, spotify.NewTrackToRemove(string(current[i]), []int{i}))
+		}
+
+		var err error
+		snapshot, err = client.RemoveTracksFromPlaylistOpt(userID, prev.PlaylistID, remove, snapshot)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, i := range dropped {
+		current = append(current[:i], current[i+1:]...)
+	}
+
+	return current, snapshot, nil
+}
+
+// missingTracks returns the tracks on the list that are not on the playlist yet, after removing dropped tracks.
+// Tracks added by others do not count, as they are not ours to move around.
+func missingTracks(current []spotify.ID, ours []spotify.ID, tracks []spotify.ID) []spotify.ID {
+	kept := countTracks(ours)
+	have := make(map[spotify.ID]int)
+	for _, id := range current {
+		if kept[id] > 0 {
+			kept[id]--
+			have[id]++
+		}
+	}
+
+	missing := make([]spotify.ID, 0)
+	for _, id := range tracks {
+		if have[id] > 0 {
+			have[id]--
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
+// reorderTracks moves the tracks of the list to the top of the playlist, in list order.
+// Everything else ends up below them in the order it was in. It returns the new snapshot ID.
+//
+// Tracks already in the right order are moved together. When that still takes more calls than writing the
+// whole playlist again, like after shuffling, the playlist is replaced instead. That is not checked against
+// the snapshot, so it is only done when every track on the playlist can be added back.
+func reorderTracks(client playlistEditor, userID string, playlistID spotify.ID, current []spotify.ID, tracks []spotify.ID, snapshot string) (string, error) {
+	moves, order, err := planMoves(current, tracks)
+	if err != nil {
+		return "", errors.New("sync: " + err.Error() + " went missing from playlist " + string(playlistID))
+	}
+
+	if len(moves) > 1+(len(order)-1)/maxTracksPerRequest && !hasLocalTracks(order) {
+		n := len(order)
+		if n > maxTracksPerRequest {
+			n = maxTracksPerRequest
+		}
+		err = client.ReplacePlaylistTracks(userID, playlistID, order[:n]...)
+		if err != nil {
+			return "", err
+		}
+
+		// replacing does not return a snapshot, the last batch added does
+		return addTracksToPlaylist(client, userID, playlistID, order[n:])
+	}
+
+	for _, move := range moves {
+		move.SnapshotID = snapshot
+		snapshot, err = client.ReorderPlaylistTracks(userID, playlistID, move)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// planMoves returns the moves that put the tracks at the top of the playlist in order, and the resulting order.
+// Runs of tracks that are already in the right order are moved at once.
+func planMoves(current []spotify.ID, tracks []spotify.ID) ([]spotify.PlaylistReorderOptions, []spotify.ID, error) {
+	order := append([]spotify.ID(nil), current...)
+	moves := make([]spotify.PlaylistReorderOptions, 0)
+	for i := 0; i < len(tracks); {
+		j := i
+		for j < len(order) && order[j] != tracks[i] {
+			j++
+		}
+		if j == len(order) {
+			return nil, nil, errors.New("track " + string(tracks[i]))
+		}
+		if j == i {
+			i++
+			continue
+		}
+
+		n := 1
+		for i+n < len(tracks) && j+n < len(order) && order[j+n] == tracks[i+n] {
+			n++
+		}
+		moves = append(moves, spotify.PlaylistReorderOptions{
+			RangeStart:   j,
+			RangeLength:  n,
+			InsertBefore: i,
+		})
+
+		run := append([]spotify.ID(nil), order[j:j+n]...)
+		copy(order[i+n:j+n], order[i:j])
+		copy(order[i:], run)
+		i += n
+	}
+
+	return moves, order, nil
+}
+
+// hasLocalTracks reports whether any of the tracks is a local file, which has no ID and can not be added through the API.
+func hasLocalTracks(tracks []spotify.ID) bool {
+	for _, id := range tracks {
+		if id == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func countTracks(tracks []spotify.ID) map[spotify.ID]int {
+	count := make(map[spotify.ID]int)
+	for _, id := range tracks {
+		count[id]++
+	}
+
+	return count
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestSyncPlaylistSkipsOtherEdition(t *testing.T) {
+	synced.Set("danny", "final-2023", syncedPlaylist{PlaylistID: "playlist2023", Edition: "2023"})
+	defer synced.Forget("danny")
+
+	list := &List{ID: "final-2023", Edition: "2024"}
+
+	// the client is never used, as there is nothing to sync for another edition
+	id, ok, err := syncPlaylist(spotify.Client{}, "danny", list, nil, playlistOptions{})
+	if id != "" || ok || err != nil {
+		t.Errorf("got %q, %v, %v, want a new playlist for another edition", id, ok, err)
+	}
+}
+
+func TestMissingTracks(t *testing.T) {
+	current := []spotify.ID{"a", "x", "b"}
+	ours := []spotify.ID{"a", "b"}
+	tracks := []spotify.ID{"a", "b", "c", "x"}
+
+	got := missingTracks(current, ours, tracks)
+	if len(got) != 2 || got[0] != "c" || got[1] != "x" {
+		t.Errorf("got %v, want c and x, as x was added by someone else", got)
+	}
+}
+
+// fakePlaylist is a playlist in memory, changed like Spotify would.
+type fakePlaylist struct {
+	tracks   []spotify.ID
+	snapshot int
+	calls    int
+}
+
+func (p *fakePlaylist) change(snapshotID string) (string, error) {
+	p.calls++
+	if snapshotID != "" && snapshotID != strconv.Itoa(p.snapshot) {
+		return "", errors.New("snapshot " + snapshotID + " is outdated")
+	}
+	p.snapshot++
+	return strconv.Itoa(p.snapshot), nil
+}
+
+func (p *fakePlaylist) AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (string, error) {
+	p.tracks = append(p.tracks, trackIDs...)
+	return p.change("")
+}
+
+func (p *fakePlaylist) RemoveTracksFromPlaylistOpt(userID string, playlistID spotify.ID, tracks []spotify.TrackToRemove, snapshotID string) (string, error) {
+	remove := make(map[int]bool)
+	for _, t := range tracks {
+		for _, i := range t.Positions {
+			if "spotify:track:"+string(p.tracks[i]) != t.URI {
+				return "", errors.New("no " + t.URI + " at position " + strconv.Itoa(i))
+			}
+			remove[i] = true
+		}
+	}
+
+	kept := make([]spotify.ID, 0, len(p.tracks))
+	for i, id := range p.tracks {
+		if !remove[i] {
+			kept = append(kept, id)
+		}
+	}
+	p.tracks = kept
+	return p.change(snapshotID)
+}
+
+func (p *fakePlaylist) ReorderPlaylistTracks(userID string, playlistID spotify.ID, opt spotify.PlaylistReorderOptions) (string, error) {
+	end := opt.RangeStart + opt.RangeLength
+	run := append([]spotify.ID(nil), p.tracks[opt.RangeStart:end]...)
+	rest := append(append([]spotify.ID(nil), p.tracks[:opt.RangeStart]...), p.tracks[end:]...)
+	at := opt.InsertBefore
+	if at > opt.RangeStart {
+		at -= opt.RangeLength
+	}
+	p.tracks = append(append(append([]spotify.ID(nil), rest[:at]...), run...), rest[at:]...)
+	return p.change(opt.SnapshotID)
+}
+
+func (p *fakePlaylist) ReplacePlaylistTracks(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) error {
+	p.tracks = append([]spotify.ID(nil), trackIDs...)
+	_, err := p.change("")
+	return err
+}
+
+func TestRemoveDroppedTracks(t *testing.T) {
+	p := &fakePlaylist{tracks: []spotify.ID{"a", "x", "b", "c", "b"}}
+	prev := syncedPlaylist{Tracks: []spotify.ID{"a", "b", "c", "b"}}
+	tracks := []spotify.ID{"c", "a", "b"}
+
+	current, snapshot, err := removeDroppedTracks(p, "danny", prev, append([]spotify.ID(nil), p.tracks...), tracks, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// one of the two b's is dropped, x was added by someone else and stays
+	want := []spotify.ID{"a", "x", "b", "c"}
+	if !reflect.DeepEqual(current, want) || !reflect.DeepEqual(p.tracks, want) {
+		t.Errorf("got %v, playlist %v, want %v", current, p.tracks, want)
+	}
+	if snapshot != "1" {
+		t.Errorf("got snapshot %q, want 1", snapshot)
+	}
+}
+
+func TestReorderTracks(t *testing.T) {
+	ids := func(s string) []spotify.ID {
+		ids := make([]spotify.ID, 0)
+		for _, id := range strings.Fields(s) {
+			if id == "local" {
+				id = ""
+			}
+			ids = append(ids, spotify.ID(id))
+		}
+		return ids
+	}
+	numbered := func(n int, reverse bool) []spotify.ID {
+		ids := make([]spotify.ID, n)
+		for i := range ids {
+			if reverse {
+				ids[n-1-i] = spotify.ID(strconv.Itoa(i))
+			} else {
+				ids[i] = spotify.ID(strconv.Itoa(i))
+			}
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name    string
+		current []spotify.ID
+		tracks  []spotify.ID
+		want    []spotify.ID
+		calls   int
+	}{
+		{"in order", ids("a b c x"), ids("a b c"), ids("a b c x"), 0},
+		{"others on top", ids("x y a b c"), ids("a b c"), ids("a b c x y"), 1},
+		{"new tracks at the end", ids("a b x c d"), ids("a c d b"), ids("a c d b x"), 1},
+		{"new edition on top", append(numbered(300, false), ids("x new1 new2")...), append(ids("new1 new2"), numbered(300, false)...), append(append(ids("new1 new2"), numbered(300, false)...), "x"), 1},
+		{"reversed", append(numbered(250, false), "x"), numbered(250, true), append(numbered(250, true), "x"), 3},
+		{"reversed with local file", ids("c b a local"), ids("a b c"), ids("a b c local"), 2},
+	}
+
+	for _, test := range tests {
+		p := &fakePlaylist{tracks: append([]spotify.ID(nil), test.current...)}
+		_, err := reorderTracks(p, "danny", "playlist", append([]spotify.ID(nil), test.current...), test.tracks, "0")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.tracks, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, p.tracks, test.want)
+		}
+		if p.calls != test.calls {
+			t.Errorf("%s: took %d calls, want %d", test.name, p.calls, test.calls)
+		}
+	}
+
+	p := &fakePlaylist{tracks: ids("a b")}
+	_, err := reorderTracks(p, "danny", "playlist", ids("a b"), ids("a c"), "0")
+	if err == nil {
+		t.Error("got no error for a track that is not on the playlist")
+	}
+}